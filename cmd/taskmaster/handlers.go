@@ -3,11 +3,22 @@ package main
 import (
 	"fmt"
 	"log/slog"
+	"os"
+	"path"
+	"strconv"
+	"time"
 
 	"github.com/souhoc/taskmaster"
 	"github.com/souhoc/taskmaster/term"
 )
 
+const (
+	defaultTailLines = 10
+
+	topInterval = 2 * time.Second
+	clearScreen = "\033[H\033[2J"
+)
+
 type Handler struct {
 	service  *taskmaster.Service
 	terminal *term.Term
@@ -17,33 +28,41 @@ func (h *Handler) SetTerminal() {
 	h.terminal.AddCmd("reload", "Reload config file.", h.Reload)
 	h.terminal.AddCmd("start", "Start one ore more processes.", h.Start)
 	h.terminal.AddCmd("stop", "Stop one ore more processes.", h.Stop)
-	h.terminal.AddCmd("status", "Display status of one or more processes", h.Status)
+	h.terminal.AddCmd("status", "Display status of one or more processes: status [-l] [process]...", h.Status)
+	h.terminal.AddCmd("run", "Run a job and wait for it to finish.", h.Run)
+	h.terminal.AddCmd("history", "Display the last runs of a task.", h.History)
+	h.terminal.AddCmd("logrotate", "Rotate the output files of one or more processes.", h.LogRotate)
+	h.terminal.AddCmd("tail", "Display the last output of a process: tail [-f] [-n N] <process> [stderr]", h.Tail)
+	h.terminal.AddCmd("events", "Display the process events as they happen: events [--task glob]... [--json]", h.Events)
+	h.terminal.AddCmd("maintail", "Display the last logs of the service: maintail [-f] [-n N]", h.MainTail)
+	h.terminal.AddCmd("top", "Display the resources used by the processes, refreshed until q is pressed.", h.Top)
+	h.terminal.AddCmd("loglevel", "Display or change the log level: loglevel [debug|info|warn|error]", h.LogLevel)
 
 	h.terminal.SetCompletions(h.service.List()...)
 }
 
 func (h *Handler) Status(args ...string) error {
+	// -l displays the resources used instead.
+	write := taskmaster.WriteInfoTable
+	if len(args) > 1 && args[1] == "-l" {
+		write = taskmaster.WriteStatsTable
+		args = append([]string{args[0]}, args[2:]...)
+	}
+
 	if len(args) == 1 {
-		args = append(args, h.service.List()...)
+		return write(os.Stdout, h.service.InfoAll())
 	}
 
+	infos := make([]taskmaster.ProcessInfo, 0, len(args)-1)
 	for _, arg := range args[1:] {
-		status := h.service.Status(arg)
-		if status == taskmaster.ProcessStatusUnknown {
-			fmt.Printf("%s %s\n", arg, status)
-			continue
-		}
-
-		pid, err := h.service.GetPid(arg)
-		if status == taskmaster.ProcessStatusRunning && err == nil {
-			fmt.Printf("%s %s %d\n", arg, status, pid)
-			continue
+		info, err := h.service.Info(arg)
+		if err != nil {
+			info = taskmaster.ProcessInfo{Name: arg, Description: err.Error()}
 		}
-
-		fmt.Printf("%s %s XXXX\n", arg, status)
+		infos = append(infos, info)
 	}
 
-	return nil
+	return write(os.Stdout, infos)
 }
 
 func (h *Handler) Start(args ...string) error {
@@ -52,7 +71,7 @@ func (h *Handler) Start(args ...string) error {
 	}
 
 	for _, arg := range args[1:] {
-		if err := h.service.Start(arg); err != nil {
+		if err := h.service.StartWait(arg); err != nil {
 			fmt.Printf("%s: %s\n", err, arg)
 			return fmt.Errorf("%s: %w", args[0], err)
 		}
@@ -94,3 +113,257 @@ func (h *Handler) Reload(_ ...string) error {
 
 	return nil
 }
+
+func (h *Handler) Run(args ...string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("%s: expected one parameter", args[0])
+	}
+
+	runs, err := h.service.Run(args[1])
+	if err != nil {
+		fmt.Printf("%s: %s\n", err, args[1])
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	success := true
+	for _, run := range runs {
+		fmt.Print(run.Output)
+		if run.ExitSignal != "" {
+			fmt.Printf("job %s killed by %s after %s\n", run.Process, run.ExitSignal, run.Duration)
+		} else {
+			fmt.Printf("job %s exited with code %d after %s\n", run.Process, run.ExitCode, run.Duration)
+		}
+		success = success && run.Success
+	}
+	if !success {
+		return fmt.Errorf("%s: job %s failed", args[0], args[1])
+	}
+
+	return nil
+}
+
+func (h *Handler) History(args ...string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("%s: expected one parameter", args[0])
+	}
+
+	runs, err := h.service.History(args[1])
+	if err != nil {
+		fmt.Printf("%s: %s\n", err, args[1])
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	return taskmaster.WriteRunTable(os.Stdout, runs)
+}
+
+func (h *Handler) Tail(args ...string) error {
+	tail, err := parseTail(args)
+	if err != nil {
+		return err
+	}
+
+	out, offset, err := h.service.Tail(tail.Name, tail.Stream, tail.Lines)
+	if err != nil {
+		fmt.Printf("%s: %s\n", err, tail.Name)
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	fmt.Print(out)
+	if !tail.Follow {
+		return nil
+	}
+
+	ctx, stop := h.terminal.Interruptible(h.service.Ctx)
+	defer stop()
+	for ctx.Err() == nil {
+		out, offset, err = h.service.Follow(ctx, tail.Name, tail.Stream, offset)
+		if err != nil {
+			fmt.Printf("%s: %s\n", err, tail.Name)
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		fmt.Print(out)
+	}
+
+	return nil
+}
+
+func (h *Handler) MainTail(args ...string) error {
+	tail, positional, err := parseTailFlags(args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return fmt.Errorf("%s: unexpected parameter: %s", args[0], positional[0])
+	}
+
+	out, offset, err := h.service.MainTail(tail.Lines)
+	if err != nil {
+		fmt.Println(err)
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	fmt.Print(out)
+	if !tail.Follow {
+		return nil
+	}
+
+	ctx, stop := h.terminal.Interruptible(h.service.Ctx)
+	defer stop()
+	for ctx.Err() == nil {
+		out, offset, err = h.service.MainFollow(ctx, offset)
+		if err != nil {
+			fmt.Println(err)
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		fmt.Print(out)
+	}
+
+	return nil
+}
+
+// parseTail parses the arguments of: tail [-f] [-n N] <process> [stderr]
+func parseTail(args []string) (taskmaster.TailArgs, error) {
+	tail, positional, err := parseTailFlags(args)
+	if err != nil {
+		return tail, err
+	}
+
+	switch len(positional) {
+	case 2:
+		tail.Stream = positional[1]
+		fallthrough
+	case 1:
+		tail.Name = positional[0]
+	default:
+		return tail, fmt.Errorf("%s: expected a process and an optional stream", args[0])
+	}
+	return tail, nil
+}
+
+// parseTailFlags parses -f and -n N, and returns the other arguments.
+func parseTailFlags(args []string) (taskmaster.TailArgs, []string, error) {
+	tail := taskmaster.TailArgs{Stream: taskmaster.OutputStdout, Lines: defaultTailLines}
+
+	var positional []string
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "-f":
+			tail.Follow = true
+		case "-n":
+			i++
+			if i == len(args) {
+				return tail, nil, fmt.Errorf("%s: -n needs a number of lines", args[0])
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				return tail, nil, fmt.Errorf("%s: invalid number of lines: %s", args[0], args[i])
+			}
+			tail.Lines = n
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	return tail, positional, nil
+}
+
+func (h *Handler) LogRotate(args ...string) error {
+	if len(args) == 1 {
+		return fmt.Errorf("%s: missing parameter", args[0])
+	}
+
+	for _, arg := range args[1:] {
+		if err := h.service.LogRotate(arg); err != nil {
+			fmt.Printf("%s: %s\n", err, arg)
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+
+		fmt.Printf("rotated output files of process: %s\n", arg)
+	}
+
+	return nil
+}
+
+func (h *Handler) Top(args ...string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("%s: unexpected parameter: %s", args[0], args[1])
+	}
+
+	ctx, stop := h.terminal.Interruptible(h.service.Ctx)
+	defer stop()
+
+	ticker := time.NewTicker(topInterval)
+	defer ticker.Stop()
+	for {
+		fmt.Print(clearScreen)
+		taskmaster.WriteStatsTable(os.Stdout, h.service.InfoAll())
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (h *Handler) LogLevel(args ...string) error {
+	switch len(args) {
+	case 1:
+	case 2:
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(args[1])); err != nil {
+			fmt.Println(err)
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		h.service.SetLogLevel(level)
+	default:
+		return fmt.Errorf("%s: expected at most one parameter", args[0])
+	}
+
+	fmt.Printf("log level: %s\n", h.service.LogLevel())
+	return nil
+}
+
+func (h *Handler) Events(args ...string) error {
+	filter, asJSON, err := parseEvents(args)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := h.terminal.Interruptible(h.service.Ctx)
+	defer stop()
+
+	events, unsubscribe := h.service.Subscribe(filter)
+	defer unsubscribe()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			taskmaster.WriteEvent(os.Stdout, e, asJSON)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// parseEvents parses the arguments of: events [--task glob]... [--json]
+func parseEvents(args []string) (taskmaster.EventFilter, bool, error) {
+	var filter taskmaster.EventFilter
+	var asJSON bool
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			asJSON = true
+		case "--task":
+			i++
+			if i == len(args) {
+				return filter, false, fmt.Errorf("%s: --task needs a glob", args[0])
+			}
+			if _, err := path.Match(args[i], ""); err != nil {
+				return filter, false, fmt.Errorf("%s: invalid glob: %s", args[0], args[i])
+			}
+			filter.Tasks = append(filter.Tasks, args[i])
+		default:
+			return filter, false, fmt.Errorf("%s: unexpected parameter: %s", args[0], args[i])
+		}
+	}
+	return filter, asJSON, nil
+}
@@ -16,39 +16,51 @@ import (
 )
 
 var (
-	logFile    *os.File
 	configPath string
 )
 
 func init() {
 	flag.StringVar(&configPath, "config", "", "Config yaml file path. (On Unix systems, it returns $XDG_CONFIG_HOME as specified by https://specifications.freedesktop.org/basedir-spec/basedir-spec-latest.html if non-empty, else $HOME/.config. On Darwin, it returns $HOME/Library/Application Support. On Windows, it returns %AppData%. On Plan 9, it returns $home/lib).")
 	flag.Parse()
+}
 
-	var err error
-	logFile, err = util.GetLogfile()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to get logfile: %v\n", err)
+func main() {
+	var cfg taskmaster.Config
+	if err := cfg.Init(configPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 
-	log.SetOutput(logFile)
-	if os.Getenv("DEBUG") == "true" {
-		log.SetFlags(log.LstdFlags | log.Lshortfile)
-		slog.SetLogLoggerLevel(slog.LevelDebug)
+	logFile, err := cfg.Log.OpenLogFile("taskmaster")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open log file: %v\n", err)
+		os.Exit(1)
 	}
-}
-
-func main() {
 	defer logFile.Close()
-	var cfg taskmaster.Config
-	if err := cfg.Init(configPath); err != nil {
+	log.SetOutput(logFile)
+
+	logOutput, outputFile, err := cfg.Log.OpenOutput(logFile)
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		logFile.Close()
 		os.Exit(1)
 	}
-
-	logger := util.NewLogger(cfg.Webhook, logFile)
+	if outputFile != nil && outputFile != logFile {
+		defer outputFile.Close()
+	}
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(cfg.Log.Level)
+	logs := taskmaster.NewLogBuffer()
+	logger := util.NewLogger(cfg.Webhook, logOutput,
+		util.WithFormat(cfg.Log.Format),
+		util.WithLevel(logLevel),
+		util.WithSource(cfg.Log.Source),
+		util.WithTee(logs),
+	)
 	slog.SetDefault(slog.New(logger))
+	if cfg.Log.Source {
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+	}
 
 	if cfg.DropToUser != "" {
 		if err := util.DropToUser(cfg.DropToUser); err != nil {
@@ -58,7 +70,7 @@ func main() {
 		}
 	}
 
-	service := taskmaster.New(&cfg, taskmaster.WithOutputFile(logFile))
+	service := taskmaster.New(&cfg, taskmaster.WithNotifier(logger), taskmaster.WithLogLevel(logLevel), taskmaster.WithLogBuffer(logs))
 
 	spinner := util.NewSinner(nil)
 	go spinner.Spin("Auto starting tasks...")
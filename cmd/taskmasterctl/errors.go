@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+// ExitCodeError makes taskmasterctl exit with Code when running a single
+// command.
+type ExitCodeError struct {
+	Code int
+}
+
+func (e *ExitCodeError) Error() string {
+	return fmt.Sprintf("exit code %d", e.Code)
+}
@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/rpc"
+	"os"
+	"path"
+	"strconv"
+	"time"
 
 	"github.com/souhoc/taskmaster"
 	"github.com/souhoc/taskmaster/term"
 )
 
 const (
-	nameWidth int = 20
+	nameWidth        int = 20
+	defaultTailLines int = 10
+
+	topInterval time.Duration = 2 * time.Second
+	clearScreen string        = "\033[H\033[2J"
 )
 
 type Handler struct {
@@ -19,10 +28,18 @@ type Handler struct {
 }
 
 func (h *Handler) SetTerminal() {
-	h.terminal.AddCmd("status", "Display status of one or more processes", h.Status)
+	h.terminal.AddCmd("status", "Display status of one or more processes: status [-l] [process]...", h.Status)
 	h.terminal.AddCmd("start", "Start one ore more processes.", h.Start)
 	h.terminal.AddCmd("stop", "Stop one ore more processes.", h.Stop)
 	h.terminal.AddCmd("reload", "Reload config file.", h.Reload)
+	h.terminal.AddCmd("run", "Run a job and wait for it to finish.", h.Run)
+	h.terminal.AddCmd("history", "Display the last runs of a task.", h.History)
+	h.terminal.AddCmd("logrotate", "Rotate the output files of one or more processes.", h.LogRotate)
+	h.terminal.AddCmd("tail", "Display the last output of a process: tail [-f] [-n N] <process> [stderr]", h.Tail)
+	h.terminal.AddCmd("events", "Display the process events as they happen: events [--task glob]... [--json]", h.Events)
+	h.terminal.AddCmd("maintail", "Display the last logs of the daemon: maintail [-f] [-n N]", h.MainTail)
+	h.terminal.AddCmd("top", "Display the resources used by the processes, refreshed until q is pressed.", h.Top)
+	h.terminal.AddCmd("loglevel", "Display or change the log level: loglevel [debug|info|warn|error]", h.LogLevel)
 
 	var processes []string
 	err := h.client.Call(taskmaster.RPCServiceList, struct{}{}, &processes)
@@ -32,37 +49,39 @@ func (h *Handler) SetTerminal() {
 }
 
 func (h *Handler) Status(args ...string) error {
+	// -l displays the resources used instead.
+	write := taskmaster.WriteInfoTable
+	if len(args) > 1 && args[1] == "-l" {
+		write = taskmaster.WriteStatsTable
+		args = append([]string{args[0]}, args[2:]...)
+	}
+
 	if len(args) == 1 {
-		var processes []string
-		if err := h.client.Call(taskmaster.RPCServiceList, struct{}{}, &processes); err != nil {
+		var infos []taskmaster.ProcessInfo
+		if err := h.client.Call(taskmaster.RPCServiceInfoAll, struct{}{}, &infos); err != nil {
 			if err == rpc.ErrShutdown {
 				fmt.Print("service is closed")
 				return term.Exit
 			}
 			return err
 		}
-		args = append(args, processes...)
+		return write(os.Stdout, infos)
 	}
 
+	infos := make([]taskmaster.ProcessInfo, 0, len(args)-1)
 	for _, arg := range args[1:] {
-		var status taskmaster.ProcessStatus
-		h.client.Call(taskmaster.RPCServiceStatus, arg, &status)
-
-		var pid int
-		err := h.client.Call(taskmaster.RPCServiceGetPid, arg, &pid)
-		if err == rpc.ErrShutdown {
-			fmt.Print("service is closed")
-			return term.Exit
-		}
-
-		if status == taskmaster.ProcessStatusRunning && err == nil {
-			fmt.Printf("%s %s %d\n", arg, status, pid)
-			continue
+		var info taskmaster.ProcessInfo
+		if err := h.client.Call(taskmaster.RPCServiceInfo, arg, &info); err != nil {
+			if err == rpc.ErrShutdown {
+				fmt.Print("service is closed")
+				return term.Exit
+			}
+			info = taskmaster.ProcessInfo{Name: arg, Description: err.Error()}
 		}
-		fmt.Printf("%s %s XXXX\n", arg, status)
+		infos = append(infos, info)
 	}
 
-	return nil
+	return write(os.Stdout, infos)
 }
 
 func (h *Handler) Start(args ...string) error {
@@ -132,3 +151,311 @@ func (h *Handler) Reload(_ ...string) error {
 
 	return nil
 }
+
+func (h *Handler) Run(args ...string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("%s: expected one parameter", args[0])
+	}
+
+	var runs []taskmaster.JobRun
+	if err := h.client.Call(taskmaster.RPCServiceRun, args[1], &runs); err != nil {
+		if err == rpc.ErrShutdown {
+			fmt.Print("service is closed")
+			return term.Exit
+		}
+
+		fmt.Printf("%s: %s\n", err, args[1])
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	var failed *taskmaster.JobRun
+	for i, run := range runs {
+		fmt.Print(run.Output)
+		if run.ExitSignal != "" {
+			fmt.Printf("job %s killed by %s after %s\n", run.Process, run.ExitSignal, run.Duration)
+		} else {
+			fmt.Printf("job %s exited with code %d after %s\n", run.Process, run.ExitCode, run.Duration)
+		}
+		if !run.Success && failed == nil {
+			failed = &runs[i]
+		}
+	}
+	if failed == nil {
+		return nil
+	}
+	// The exit code of the first failed job, or 1 if it would read as a
+	// success.
+	if failed.ExitSignal != "" || failed.ExitCode == 0 {
+		return &ExitCodeError{Code: 1}
+	}
+	return &ExitCodeError{Code: failed.ExitCode}
+}
+
+func (h *Handler) History(args ...string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("%s: expected one parameter", args[0])
+	}
+
+	var runs []taskmaster.JobRun
+	if err := h.client.Call(taskmaster.RPCServiceHistory, args[1], &runs); err != nil {
+		if err == rpc.ErrShutdown {
+			fmt.Print("service is closed")
+			return term.Exit
+		}
+
+		fmt.Printf("%s: %s\n", err, args[1])
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	return taskmaster.WriteRunTable(os.Stdout, runs)
+}
+
+func (h *Handler) Tail(args ...string) error {
+	tail, err := parseTail(args)
+	if err != nil {
+		return err
+	}
+
+	return h.tail(args[0], taskmaster.RPCServiceTail, tail)
+}
+
+func (h *Handler) MainTail(args ...string) error {
+	tail, positional, err := parseTailFlags(args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return fmt.Errorf("%s: unexpected parameter: %s", args[0], positional[0])
+	}
+
+	return h.tail(args[0], taskmaster.RPCServiceMainTail, tail)
+}
+
+// tail prints the reply of a Tail or a MainTail call, then follows it.
+func (h *Handler) tail(cmd, method string, tail taskmaster.TailArgs) error {
+	follow := tail.Follow
+	tail.Follow = false
+
+	var ctx context.Context
+	stop := func() {}
+	if follow {
+		ctx, stop = h.terminal.Interruptible(context.Background())
+	}
+	defer stop()
+
+	for {
+		var reply taskmaster.TailReply
+		call := h.client.Go(method, tail, &reply, nil)
+		if follow {
+			select {
+			case <-call.Done:
+			case <-ctx.Done():
+				return nil
+			}
+		} else {
+			<-call.Done
+		}
+		if err := call.Error; err != nil {
+			if err == rpc.ErrShutdown {
+				fmt.Print("service is closed")
+				return term.Exit
+			}
+
+			if tail.Name != "" {
+				fmt.Printf("%s: %s\n", err, tail.Name)
+			} else {
+				fmt.Println(err)
+			}
+			return fmt.Errorf("%s: %w", cmd, err)
+		}
+
+		fmt.Print(reply.Output)
+		if !follow {
+			return nil
+		}
+		tail.Follow = true
+		tail.Offset = reply.Offset
+	}
+}
+
+// parseTail parses the arguments of: tail [-f] [-n N] <process> [stderr]
+func parseTail(args []string) (taskmaster.TailArgs, error) {
+	tail, positional, err := parseTailFlags(args)
+	if err != nil {
+		return tail, err
+	}
+
+	switch len(positional) {
+	case 2:
+		tail.Stream = positional[1]
+		fallthrough
+	case 1:
+		tail.Name = positional[0]
+	default:
+		return tail, fmt.Errorf("%s: expected a process and an optional stream", args[0])
+	}
+	return tail, nil
+}
+
+// parseTailFlags parses -f and -n N, and returns the other arguments.
+func parseTailFlags(args []string) (taskmaster.TailArgs, []string, error) {
+	tail := taskmaster.TailArgs{Stream: taskmaster.OutputStdout, Lines: defaultTailLines}
+
+	var positional []string
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "-f":
+			tail.Follow = true
+		case "-n":
+			i++
+			if i == len(args) {
+				return tail, nil, fmt.Errorf("%s: -n needs a number of lines", args[0])
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				return tail, nil, fmt.Errorf("%s: invalid number of lines: %s", args[0], args[i])
+			}
+			tail.Lines = n
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	return tail, positional, nil
+}
+
+func (h *Handler) LogRotate(args ...string) error {
+	if len(args) == 1 {
+		return fmt.Errorf("%s: missing parameter", args[0])
+	}
+
+	for _, arg := range args[1:] {
+		if err := h.client.Call(taskmaster.RPCServiceLogRotate, arg, nil); err != nil {
+			if err == rpc.ErrShutdown {
+				fmt.Print("service is closed")
+				return term.Exit
+			}
+
+			fmt.Printf("%s: %s\n", err, arg)
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+
+		fmt.Printf("rotated output files of process: %s\n", arg)
+	}
+
+	return nil
+}
+
+func (h *Handler) Top(args ...string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("%s: unexpected parameter: %s", args[0], args[1])
+	}
+
+	ctx, stop := h.terminal.Interruptible(context.Background())
+	defer stop()
+
+	ticker := time.NewTicker(topInterval)
+	defer ticker.Stop()
+	for {
+		var infos []taskmaster.ProcessInfo
+		if err := h.client.Call(taskmaster.RPCServiceInfoAll, struct{}{}, &infos); err != nil {
+			if err == rpc.ErrShutdown {
+				fmt.Print("service is closed")
+				return term.Exit
+			}
+
+			fmt.Println(err)
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+
+		fmt.Print(clearScreen)
+		taskmaster.WriteStatsTable(os.Stdout, infos)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (h *Handler) LogLevel(args ...string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("%s: expected at most one parameter", args[0])
+	}
+
+	var level, reply string
+	if len(args) == 2 {
+		level = args[1]
+	}
+	if err := h.client.Call(taskmaster.RPCServiceLogLevel, level, &reply); err != nil {
+		if err == rpc.ErrShutdown {
+			fmt.Print("service is closed")
+			return term.Exit
+		}
+
+		fmt.Println(err)
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	fmt.Printf("log level: %s\n", reply)
+	return nil
+}
+
+func (h *Handler) Events(args ...string) error {
+	filter, asJSON, err := parseEvents(args)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := h.terminal.Interruptible(context.Background())
+	defer stop()
+
+	events := taskmaster.EventsArgs{Filter: filter}
+	for {
+		var reply taskmaster.EventsReply
+		call := h.client.Go(taskmaster.RPCServiceEvents, events, &reply, nil)
+		select {
+		case <-call.Done:
+		case <-ctx.Done():
+			return nil
+		}
+		if err := call.Error; err != nil {
+			if err == rpc.ErrShutdown {
+				fmt.Print("service is closed")
+				return term.Exit
+			}
+
+			fmt.Println(err)
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+
+		for _, e := range reply.Events {
+			taskmaster.WriteEvent(os.Stdout, e, asJSON)
+		}
+		events.Follow = true
+		events.Seq = reply.Seq
+	}
+}
+
+// parseEvents parses the arguments of: events [--task glob]... [--json]
+func parseEvents(args []string) (taskmaster.EventFilter, bool, error) {
+	var filter taskmaster.EventFilter
+	var asJSON bool
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			asJSON = true
+		case "--task":
+			i++
+			if i == len(args) {
+				return filter, false, fmt.Errorf("%s: --task needs a glob", args[0])
+			}
+			if _, err := path.Match(args[i], ""); err != nil {
+				return filter, false, fmt.Errorf("%s: invalid glob: %s", args[0], args[i])
+			}
+			filter.Tasks = append(filter.Tasks, args[i])
+		default:
+			return filter, false, fmt.Errorf("%s: unexpected parameter: %s", args[0], args[i])
+		}
+	}
+	return filter, asJSON, nil
+}
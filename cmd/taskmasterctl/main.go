@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
@@ -8,6 +9,7 @@ import (
 	"net/rpc"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/souhoc/taskmaster"
@@ -16,22 +18,18 @@ import (
 )
 
 var (
-	logFile *os.File
+	logFile *taskmaster.LogFile
 )
 
 func init() {
 	var err error
-	logFile, err = util.GetLogfile()
+	logFile, err = taskmaster.LogConfig{}.OpenLogFile("taskmasterctl")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to get logfile: %v\n", err)
+		fmt.Fprintf(os.Stderr, "failed to open log file: %v\n", err)
 		os.Exit(1)
 	}
 
 	log.SetOutput(logFile)
-	if os.Getenv("DEBUG") == "true" {
-		log.SetFlags(log.LstdFlags | log.Lshortfile)
-		slog.SetLogLoggerLevel(slog.LevelDebug)
-	}
 
 	log.SetPrefix("taskmasterctl ")
 	logger := util.NewLogger("", logFile)
@@ -52,19 +50,38 @@ func main() {
 	}
 	defer client.Close()
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(sigChan)
-
 	t := term.New()
 	handler := Handler{client: client, terminal: t}
 	handler.SetTerminal()
 
+	// A command given as arguments is run once, e.g. from scripts.
+	if len(os.Args) > 1 {
+		os.Exit(exitCode(t.Exec(strings.Join(os.Args[1:], " "))))
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
 	go handleSignals(sigChan, t)
 
 	t.Run()
 }
 
+// exitCode returns the exit code of taskmasterctl after a command returned
+// err.
+func exitCode(err error) int {
+	var exitErr *ExitCodeError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.Code
+	default:
+		return 1
+	}
+}
+
 func handleSignals(sigChan chan os.Signal, program *term.Term) {
 	defer signal.Stop(sigChan)
 	for {
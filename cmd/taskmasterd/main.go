@@ -8,11 +8,13 @@ import (
 	"log"
 	"log/slog"
 	"net"
+	"net/http"
 	"net/rpc"
 	"os"
 	"os/exec"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/souhoc/taskmaster"
 	"github.com/souhoc/taskmaster/util"
@@ -28,11 +30,6 @@ func init() {
 	flag.StringVar(&configPath, "config", "", "Config yaml file path. (On Unix systems, it returns $XDG_CONFIG_HOME as specified by https://specifications.freedesktop.org/basedir-spec/basedir-spec-latest.html if non-empty, else $HOME/.config. On Darwin, it returns $HOME/Library/Application Support. On Windows, it returns %AppData%. On Plan 9, it returns $home/lib).")
 	flag.Parse()
 
-	if os.Getenv("DEBUG") == "true" {
-		log.SetFlags(log.LstdFlags | log.Lshortfile)
-		slog.SetLogLoggerLevel(slog.LevelDebug)
-		slog.Warn("DEBUG=true")
-	}
 	log.SetPrefix("taskmasterd ")
 }
 
@@ -48,8 +45,41 @@ func main() {
 		os.Exit(1)
 	}
 
-	logger := util.NewLogger(cfg.Webhook, os.Stdout)
+	logFile, err := cfg.Log.OpenLogFile("taskmasterd")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open log file: %v\n", err)
+		os.Exit(1)
+	}
+	defer logFile.Close()
+	if err := logFile.FollowStdio(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open log file: %v\n", err)
+		os.Exit(1)
+	}
+
+	logOutput, outputFile, err := cfg.Log.OpenOutput(logFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// Both are reopened on SIGUSR1.
+	logFiles := []*taskmaster.LogFile{logFile}
+	if outputFile != nil && outputFile != logFile {
+		defer outputFile.Close()
+		logFiles = append(logFiles, outputFile)
+	}
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(cfg.Log.Level)
+	logs := taskmaster.NewLogBuffer()
+	logger := util.NewLogger(cfg.Webhook, logOutput,
+		util.WithFormat(cfg.Log.Format),
+		util.WithLevel(logLevel),
+		util.WithSource(cfg.Log.Source),
+		util.WithTee(logs),
+	)
 	slog.SetDefault(slog.New(logger))
+	if cfg.Log.Source {
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+	}
 
 	if cfg.DropToUser != "" {
 		if err := util.DropToUser(cfg.DropToUser); err != nil {
@@ -58,7 +88,7 @@ func main() {
 		}
 	}
 
-	service := taskmaster.New(&cfg)
+	service := taskmaster.New(&cfg, taskmaster.WithNotifier(logger), taskmaster.WithLogLevel(logLevel), taskmaster.WithLogBuffer(logs))
 	rpcService := taskmaster.NewRPCService(service)
 
 	if err := rpc.Register(rpcService); err != nil {
@@ -73,16 +103,27 @@ func main() {
 	}
 	defer os.Remove(taskmaster.SocketName)
 
+	metrics := taskmaster.NewMetrics(service)
+	if cfg.Metrics.Address != "" {
+		server, err := serveMetrics(cfg.Metrics.Address, metrics)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Remove(taskmaster.SocketName)
+			os.Exit(1)
+		}
+		defer server.Close()
+	}
+
 	// Run service only if the server can listen
 	service.AutoStart()()
 
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
 	done := make(chan struct{})
-	go handleEvents(sigChan, lis, service, done)
+	go handleEvents(sigChan, lis, service, logFiles, done)
 
 	fmt.Printf("Server listening %s...\n", taskmaster.SocketName)
-	go handleConns(lis)
+	go handleConns(lis, metrics)
 
 	<-done
 	if err := service.Close(); err != nil {
@@ -103,7 +144,7 @@ func main() {
 	return
 }
 
-func handleEvents(sigChan chan os.Signal, lis net.Listener, service *taskmaster.Service, done chan<- struct{}) {
+func handleEvents(sigChan chan os.Signal, lis net.Listener, service *taskmaster.Service, logFiles []*taskmaster.LogFile, done chan<- struct{}) {
 	defer signal.Stop(sigChan)
 	for {
 		select {
@@ -123,12 +164,41 @@ func handleEvents(sigChan chan os.Signal, lis net.Listener, service *taskmaster.
 				} else {
 					slog.Info("config reloaded", slog.Bool("changed?", changed))
 				}
+			case syscall.SIGUSR1:
+				for _, logFile := range logFiles {
+					if err := logFile.Reopen(); err != nil {
+						slog.Error("failed to reopen log file", slog.Any("error", err))
+					}
+				}
+				slog.Info("log files reopened on SIGUSR1")
 			}
 		}
 	}
 }
 
-func handleConns(lis net.Listener) {
+// serveMetrics serves the metrics over HTTP on address.
+func serveMetrics(address string, metrics *taskmaster.Metrics) (*http.Server, error) {
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(taskmaster.MetricsPath, metrics)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server stopped", slog.Any("error", err))
+		}
+	}()
+	slog.Info("serving metrics", slog.String("address", lis.Addr().String()))
+	return server, nil
+}
+
+func handleConns(lis net.Listener, metrics *taskmaster.Metrics) {
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
@@ -139,7 +209,7 @@ func handleConns(lis net.Listener) {
 			fmt.Printf("Error while accepting a connection: %s", err)
 			continue
 		}
-		go rpc.ServeConn(conn)
+		go metrics.ServeConn(rpc.DefaultServer, conn)
 	}
 }
 
@@ -158,11 +228,21 @@ func deamonize() {
 		Setsid: true,
 	}
 
-	logFile, err := util.GetLogfile()
+	// The daemon logs to the same file, which also gets what it prints.
+	var cfg taskmaster.Config
+	if err := cfg.Init(configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to init config: %v\n", err)
+		os.Exit(1)
+	}
+	logPath, err := cfg.Log.FilePath("taskmasterd")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to get logfile: %v\n", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open log file: %v\n", err)
 		os.Exit(1)
-
 	}
 	defer logFile.Close()
 
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
 
@@ -15,8 +16,13 @@ import (
 var paths []string = []string{"config.yaml"}
 
 type Config struct {
+	// The webhook the logs are posted to. It is read at startup.
 	Webhook    string           `yaml:"webhook"`
+	Notifiers  []NotifierConfig `yaml:"notifiers"`
+	Log        LogConfig        `yaml:"log"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
 	DropToUser string           `yaml:"dropToUser"`
+	StateFile  string           `yaml:"statefile"`
 	Tasks      map[string]*Task `yaml:"tasks"`
 }
 
@@ -72,6 +78,20 @@ func (c *Config) Load() error {
 		}
 	}
 
+	if c.StateFile == "" {
+		c.StateFile = defaultStateFile()
+	}
+
+	if err := c.Log.check(); err != nil {
+		return err
+	}
+
+	for i, notifier := range c.Notifiers {
+		if err := notifier.check(i); err != nil {
+			return err
+		}
+	}
+
 	// Verify each tasks and init task.done
 	for name, task := range c.Tasks {
 		if strings.Contains(name, "_") {
@@ -84,6 +104,17 @@ func (c *Config) Load() error {
 			task.NumProcs = 1
 		}
 
+		switch task.Type {
+		case "":
+			task.Type = TaskTypeService
+		case TaskTypeService, TaskTypeOneshot, TaskTypeEventListener:
+		default:
+			return fmt.Errorf("config: task %s: unknown type: %s", name, task.Type)
+		}
+		if err := task.checkListener(name); err != nil {
+			return err
+		}
+
 		if task.StopTime <= time.Duration(0) {
 			task.StopTime = defaultStopTime
 		}
@@ -95,14 +126,64 @@ func (c *Config) Load() error {
 		if task.StartRetries == 0 {
 			task.StartRetries = defaultStartRetries
 		}
+
+		if task.Backoff.Initial <= time.Duration(0) {
+			task.Backoff.Initial = defaultBackoffInitial
+		}
+		if task.Backoff.Multiplier < 1 {
+			task.Backoff.Multiplier = defaultBackoffMultiplier
+		}
+		if task.Backoff.Max < task.Backoff.Initial {
+			task.Backoff.Max = max(defaultBackoffMax, task.Backoff.Initial)
+		}
+		if task.Backoff.Jitter < 0 || task.Backoff.Jitter > 1 {
+			return fmt.Errorf("config: backoff jitter must be between 0 and 1: task %s has %v", name, task.Backoff.Jitter)
+		}
+		if task.Backoff.Reset <= time.Duration(0) {
+			task.Backoff.Reset = defaultBackoffReset
+		}
+
+		if task.MaxRestarts < 0 {
+			return fmt.Errorf("config: negative maxrestarts: task %s has %d", name, task.MaxRestarts)
+		}
+		if task.RestartWindow <= time.Duration(0) {
+			task.RestartWindow = defaultRestartWindow
+		}
+
+		if task.RedirectStderr && task.Stderr != "" {
+			return fmt.Errorf("config: task %s has both redirect_stderr and stderr", name)
+		}
+		if err := task.Syslog.check(name); err != nil {
+			return err
+		}
+		if task.StdoutBackups < 0 || task.StderrBackups < 0 {
+			return fmt.Errorf("config: negative output backups: task %s", name)
+		}
+
+		if task.Watchdog > time.Duration(0) && !task.Notify {
+			return fmt.Errorf("config: task %s has a watchdog without notify", name)
+		}
+
+		if task.HealthCheck != nil {
+			if err := task.HealthCheck.init(name); err != nil {
+				return err
+			}
+		}
+
+		if err := task.checkSchedule(name); err != nil {
+			return err
+		}
+		if err := task.checkLimits(name); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return checkDependencies(c.Tasks)
 }
 
 // Compare returns true if c is the same as d
 func (c Config) Compare(d Config) bool {
-	if len(c.Tasks) != len(d.Tasks) {
+	if len(c.Tasks) != len(d.Tasks) || !reflect.DeepEqual(c.Notifiers, d.Notifiers) {
 		return false
 	}
 
@@ -0,0 +1,222 @@
+package taskmaster
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule gives the activation times of a scheduled task.
+type cronSchedule interface {
+	// next returns the first activation time after t, or the zero time if
+	// there is none.
+	next(t time.Time) time.Time
+}
+
+// everySchedule activates at a fixed interval.
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (e everySchedule) next(t time.Time) time.Time {
+	return t.Truncate(time.Second).Add(e.interval)
+}
+
+// cronSpec activates on the times matching a cron expression. Each field is
+// a bitset of the matching values.
+type cronSpec struct {
+	second, minute, hour, dom, month, dow uint64
+	domStar, dowStar                      bool
+}
+
+type cronBounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronSeconds = cronBounds{0, 59, nil}
+	cronMinutes = cronBounds{0, 59, nil}
+	cronHours   = cronBounds{0, 23, nil}
+	cronDoms    = cronBounds{1, 31, nil}
+	cronMonths  = cronBounds{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDows = cronBounds{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	cronDescriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// parseSchedule parses a cron expression with 5 fields (minute hour
+// day-of-month month day-of-week), 6 fields (with seconds first), a
+// descriptor like @daily, or an interval like @every 5m.
+func parseSchedule(expr string) (cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if interval, found := strings.CutPrefix(expr, "@every "); found {
+		d, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval: %w", err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("interval must be at least 1s: %s", d)
+		}
+		return everySchedule{interval: d}, nil
+	}
+	if descriptor, exists := cronDescriptors[expr]; exists {
+		expr = descriptor
+	}
+
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("expected 5 or 6 fields, found %d: %s", len(fields), expr)
+	}
+
+	var spec cronSpec
+	var err error
+	for i, f := range []struct {
+		bits   *uint64
+		bounds cronBounds
+	}{
+		{&spec.second, cronSeconds},
+		{&spec.minute, cronMinutes},
+		{&spec.hour, cronHours},
+		{&spec.dom, cronDoms},
+		{&spec.month, cronMonths},
+		{&spec.dow, cronDows},
+	} {
+		if *f.bits, err = parseCronField(fields[i], f.bounds); err != nil {
+			return nil, fmt.Errorf("field %q: %w", fields[i], err)
+		}
+	}
+	// Sunday is both 0 and 7.
+	if spec.dow&(1<<7) != 0 {
+		spec.dow |= 1
+	}
+	spec.domStar = fields[3] == "*" || fields[3] == "?"
+	spec.dowStar = fields[5] == "*" || fields[5] == "?"
+
+	return spec, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and steps.
+func parseCronField(expr string, bounds cronBounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepExpr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step: %s", stepExpr)
+			}
+		}
+
+		lo, hi := bounds.min, bounds.max
+		if rangeExpr != "*" && rangeExpr != "?" {
+			from, to, isRange := strings.Cut(rangeExpr, "-")
+			var err error
+			if lo, err = bounds.value(from); err != nil {
+				return 0, err
+			}
+			switch {
+			case isRange:
+				if hi, err = bounds.value(to); err != nil {
+					return 0, err
+				}
+			case !hasStep:
+				hi = lo
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid range: %s", rangeExpr)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (b cronBounds) value(expr string) (int, error) {
+	if v, exists := b.names[strings.ToLower(expr)]; exists {
+		return v, nil
+	}
+	v, err := strconv.Atoi(expr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value: %s", expr)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("value out of range [%d, %d]: %d", b.min, b.max, v)
+	}
+	return v, nil
+}
+
+func (c cronSpec) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<t.Day()) != 0
+	dowMatch := c.dow&(1<<t.Weekday()) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func (c cronSpec) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Second).Add(time.Second)
+	yearLimit := t.Year() + 5
+
+wrap:
+	for t.Year() <= yearLimit {
+		for c.month&(1<<t.Month()) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			if t.Month() == time.January {
+				continue wrap
+			}
+		}
+		for !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			if t.Day() == 1 {
+				continue wrap
+			}
+		}
+		for c.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			if t.Hour() == 0 {
+				continue wrap
+			}
+		}
+		for c.minute&(1<<t.Minute()) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			if t.Minute() == 0 {
+				continue wrap
+			}
+		}
+		for c.second&(1<<t.Second()) == 0 {
+			t = t.Add(time.Second)
+			if t.Second() == 0 {
+				continue wrap
+			}
+		}
+		return t
+	}
+
+	return time.Time{}
+}
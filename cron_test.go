@@ -0,0 +1,56 @@
+package taskmaster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	base := time.Date(2025, time.March, 14, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, time.March, 14, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, time.March, 14, 10, 45, 0, 0, time.UTC)},
+		{"30 * * * * *", time.Date(2025, time.March, 14, 10, 30, 30, 0, time.UTC)},
+		{"0 9-17 * * mon-fri", time.Date(2025, time.March, 14, 11, 0, 0, 0, time.UTC)},
+		{"0 0 * * sun", time.Date(2025, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 31 * *", time.Date(2025, time.March, 31, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, time.March, 15, 0, 0, 0, 0, time.UTC)},
+		{"@every 5m", time.Date(2025, time.March, 14, 10, 35, 15, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		spec, err := parseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got := spec.next(base); !got.Equal(tt.want) {
+			t.Errorf("%s: expected %s, got %s", tt.expr, tt.want, got)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@every 10ms",
+		"@every soon",
+	} {
+		if _, err := parseSchedule(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
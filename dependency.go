@@ -0,0 +1,280 @@
+package taskmaster
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	DependsStarted   dependsCondition = "started"
+	DependsCompleted dependsCondition = "completed"
+	DependsHealthy   dependsCondition = "healthy"
+)
+
+type dependsCondition string
+
+// checkDependencies verifies that every dependency exists, has a known
+// condition, and that there is no cycle between tasks.
+func checkDependencies(tasks map[string]*Task) error {
+	for _, name := range slices.Sorted(maps.Keys(tasks)) {
+		for dep, cond := range tasks[name].DependsOn {
+			if _, exists := tasks[dep]; !exists {
+				return fmt.Errorf("config: task %s depends on unknown task %s", name, dep)
+			}
+			switch cond {
+			case "", DependsStarted, DependsCompleted:
+			case DependsHealthy:
+				if tasks[dep].HealthCheck == nil {
+					return fmt.Errorf("config: task %s waits for %s to be healthy, but it has no healthcheck", name, dep)
+				}
+			default:
+				return fmt.Errorf("config: task %s has unknown condition for %s: %s", name, dep, cond)
+			}
+			if tasks[dep].Priority > tasks[name].Priority {
+				return fmt.Errorf("config: task %s (priority %d) depends on task %s with a later priority %d",
+					name, tasks[name].Priority, dep, tasks[dep].Priority)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(tasks))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			idx := slices.Index(path, name)
+			cycle := append(slices.Clone(path[idx:]), name)
+			return fmt.Errorf("config: dependency cycle: %s", strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range slices.Sorted(maps.Keys(tasks[name].DependsOn)) {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(tasks)) {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// taskProcesses returns the processes of a task.
+func (s *Service) taskProcesses(taskName string) map[string]*Process {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	processes := make(map[string]*Process)
+	for name, process := range s.processes {
+		if process.taskName == taskName {
+			processes[name] = process
+		}
+	}
+	return processes
+}
+
+// satisfies returns true if the process already meets cond.
+func (p *Process) satisfies(cond dependsCondition) bool {
+	info := p.Info()
+	switch cond {
+	case DependsCompleted:
+		return info.State == ProcessStatusExited && p.task.isExpectedExitCode(info.ExitCode)
+	case DependsHealthy:
+		return info.State == ProcessStatusRunning && info.Health == HealthStatusHealthy
+	default:
+		return info.State == ProcessStatusRunning
+	}
+}
+
+// waitDependency waits until the process meets cond, or can't meet it
+// anymore.
+func (s *Service) waitDependency(process *Process, cond dependsCondition) error {
+	switch cond {
+	case DependsCompleted:
+		status := process.wait(s.Ctx,
+			ProcessStatusExited,
+			ProcessStatusStopped,
+			ProcessStatusFatal,
+		)
+		if !process.satisfies(DependsCompleted) {
+			return fmt.Errorf("%w: %s", ErrDependencyFailed, status)
+		}
+		return nil
+	case DependsHealthy:
+		status, health := process.waitFor(s.Ctx, func(status ProcessStatus, health HealthStatus) bool {
+			switch status {
+			case ProcessStatusExited, ProcessStatusStopping, ProcessStatusStopped, ProcessStatusFatal:
+				return true
+			}
+			return health == HealthStatusHealthy
+		})
+		if health != HealthStatusHealthy {
+			return fmt.Errorf("%w: %s", ErrDependencyFailed, status)
+		}
+		return nil
+	default:
+		status := process.wait(s.Ctx,
+			ProcessStatusRunning,
+			ProcessStatusExited,
+			ProcessStatusStopping,
+			ProcessStatusStopped,
+			ProcessStatusFatal,
+		)
+		if status != ProcessStatusRunning && status != ProcessStatusExited {
+			return fmt.Errorf("%w: %s", ErrDependencyFailed, status)
+		}
+		return nil
+	}
+}
+
+// withDependencies adds to names the processes of the tasks they depend on,
+// which are neither active nor already meeting the condition.
+func (s *Service) withDependencies(names []string) []string {
+	names = slices.Clone(names)
+	for i := 0; i < len(names); i++ {
+		process, err := s.process(names[i])
+		if err != nil {
+			continue
+		}
+		for dep, cond := range process.task.DependsOn {
+			for depName, depProcess := range s.taskProcesses(dep) {
+				if slices.Contains(names, depName) {
+					continue
+				}
+				if depProcess.Status().active() || depProcess.satisfies(cond) {
+					continue
+				}
+				names = append(names, depName)
+			}
+		}
+	}
+	return names
+}
+
+// withDependents adds to names the active processes of the tasks depending
+// on them.
+func (s *Service) withDependents(names []string) []string {
+	names = slices.Clone(names)
+	for i := 0; i < len(names); i++ {
+		process, err := s.process(names[i])
+		if err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		for name, other := range s.processes {
+			if _, depends := other.task.DependsOn[process.taskName]; !depends {
+				continue
+			}
+			if slices.Contains(names, name) || !other.Status().active() {
+				continue
+			}
+			names = append(names, name)
+		}
+		s.mu.Unlock()
+	}
+	return names
+}
+
+// startOrdered starts the processes with their dependencies, one priority
+// tier at a time in ascending order. Within a tier, each process is started
+// once the processes of the tasks it depends on meet their condition,
+// processes without pending dependencies start in parallel.
+func (s *Service) startOrdered(names []string) error {
+	names = s.withDependencies(names)
+	started := make(map[string]chan struct{}, len(names))
+	for _, name := range names {
+		started[name] = make(chan struct{})
+	}
+
+	var errs []error
+	for _, tier := range s.tiers(names) {
+		err := s.Batch(func(name string) error {
+			defer close(started[name])
+
+			process, err := s.process(name)
+			if err != nil {
+				return err
+			}
+			for dep, cond := range process.task.DependsOn {
+				for depName, depProcess := range s.taskProcesses(dep) {
+					if c, ok := started[depName]; ok {
+						<-c
+					}
+					if err := s.waitDependency(depProcess, cond); err != nil {
+						return fmt.Errorf("%s: %w", depName, err)
+					}
+				}
+			}
+
+			err = s.StartWait(name)
+			if errors.Is(err, ErrProcessAlreadyStarted) {
+				return nil
+			}
+			return err
+		}, tier)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stopOrdered stops the processes one priority tier at a time in descending
+// order. Within a tier, each process is stopped once the processes of the
+// tasks depending on it are stopped.
+func (s *Service) stopOrdered(names []string) error {
+	stopped := make(map[string]chan struct{}, len(names))
+	for _, name := range names {
+		stopped[name] = make(chan struct{})
+	}
+
+	tiers := s.tiers(names)
+	slices.Reverse(tiers)
+
+	var errs []error
+	for _, tier := range tiers {
+		err := s.Batch(func(name string) error {
+			defer close(stopped[name])
+
+			process, err := s.process(name)
+			if err != nil {
+				return err
+			}
+			for _, other := range tier {
+				otherProcess, err := s.process(other)
+				if err != nil {
+					continue
+				}
+				if _, depends := otherProcess.task.DependsOn[process.taskName]; depends {
+					<-stopped[other]
+				}
+			}
+
+			return s.Stop(name)
+		}, tier)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
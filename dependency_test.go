@@ -0,0 +1,101 @@
+package taskmaster
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckDependencies(t *testing.T) {
+	tasks := map[string]*Task{
+		"api":     {DependsOn: map[string]dependsCondition{"queue": DependsStarted, "migrate": DependsCompleted}},
+		"queue":   {},
+		"migrate": {DependsOn: map[string]dependsCondition{"queue": ""}},
+	}
+	if err := checkDependencies(tasks); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	tasks["queue"].DependsOn = map[string]dependsCondition{"api": DependsStarted}
+	err := checkDependencies(tasks)
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle") {
+		t.Errorf("Expected a dependency cycle error, got %v", err)
+	}
+
+	tasks["queue"].DependsOn = map[string]dependsCondition{"db": DependsStarted}
+	if err := checkDependencies(tasks); err == nil {
+		t.Error("Expected an unknown dependency error")
+	}
+
+	tasks["queue"].DependsOn = map[string]dependsCondition{"migrate": "healthy-ish"}
+	if err := checkDependencies(tasks); err == nil {
+		t.Error("Expected an unknown condition error")
+	}
+
+	tasks["queue"].DependsOn = nil
+	tasks["queue"].Priority = 10
+	if err := checkDependencies(tasks); err == nil {
+		t.Error("Expected a dependency with a later priority to be refused")
+	}
+}
+
+func TestService_DependencyOrder(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"queue": {
+				Cmd:          "sleep",
+				Args:         []string{"10"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    time.Millisecond * 200,
+				StopTime:     time.Second,
+			},
+			"migrate": {
+				// Considered started right away, as it exits immediately.
+				Cmd:          "true",
+				NumProcs:     1,
+				StartRetries: 1,
+				StopTime:     time.Second,
+			},
+			"api": {
+				Cmd:          "sleep",
+				Args:         []string{"10"},
+				NumProcs:     1,
+				AutoStart:    true,
+				StartRetries: 1,
+				StartTime:    time.Millisecond * 10,
+				StopTime:     time.Second,
+				DependsOn: map[string]dependsCondition{
+					"queue":   DependsStarted,
+					"migrate": DependsCompleted,
+				},
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Cancel(nil)
+
+	s.AutoStart()()
+
+	queue, _ := s.Info("queue")
+	migrate, _ := s.Info("migrate")
+	api, _ := s.Info("api")
+	if queue.State != ProcessStatusRunning || migrate.State != ProcessStatusExited || api.State != ProcessStatusRunning {
+		t.Fatalf("Expected queue Running, migrate Exited, api Running, got %s %s %s", queue.State, migrate.State, api.State)
+	}
+	if api.StartTime.Before(queue.StartTime.Add(cfg.Tasks["queue"].StartTime)) {
+		t.Error("Expected api to start after queue was running")
+	}
+	if api.StartTime.Before(migrate.ExitTime) {
+		t.Error("Expected api to start after migrate completed")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Expected Close to succeed, got %v", err)
+	}
+	queue, _ = s.Info("queue")
+	api, _ = s.Info("api")
+	if queue.ExitTime.Before(api.ExitTime) {
+		t.Error("Expected api to stop before queue")
+	}
+}
@@ -7,6 +7,13 @@ var (
 	ErrProcessAlreadyStarted = errors.New("process's already started")
 	ErrProcessNil            = errors.New("process's nil")
 	ErrProcessIsNotRunning   = errors.New("process is not running")
+	ErrProcessStartFailed    = errors.New("process failed to start")
+	ErrInvalidTransition     = errors.New("invalid process state transition")
+	ErrDependencyFailed      = errors.New("dependency failed")
+	ErrProcessNotJob         = errors.New("process doesn't run to completion")
+	ErrTaskUnknown           = errors.New("task's unknown")
+	ErrProcessNoLogFile      = errors.New("process has no log file")
+	ErrNoLogBuffer           = errors.New("service doesn't keep its logs")
 
 	ServiceClosed = errors.New("service closed")
 )
@@ -0,0 +1,394 @@
+package taskmaster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+// The events of a process are emitted as it enters each state.
+const (
+	EventProcessStarting EventType = "starting"
+	EventProcessRunning  EventType = "running"
+	EventProcessBackoff  EventType = "backoff"
+	EventProcessStopping EventType = "stopping"
+	EventProcessStopped  EventType = "stopped"
+	// A process exited on its own, at warn level if its exit was unexpected.
+	EventProcessExited EventType = "exited"
+	// A process gave up starting or restarting.
+	EventProcessFatal EventType = "fatal"
+	// A process crossed a resource limit of its task.
+	EventProcessLimit EventType = "limit"
+	// The configuration was reloaded, or failed to be.
+	EventConfigReloaded EventType = "reload"
+)
+
+var eventTypes = []EventType{
+	EventProcessStarting,
+	EventProcessRunning,
+	EventProcessBackoff,
+	EventProcessStopping,
+	EventProcessStopped,
+	EventProcessExited,
+	EventProcessFatal,
+	EventProcessLimit,
+	EventConfigReloaded,
+}
+
+var stateEvents = map[ProcessStatus]EventType{
+	ProcessStatusStarting: EventProcessStarting,
+	ProcessStatusRunning:  EventProcessRunning,
+	ProcessStatusBackoff:  EventProcessBackoff,
+	ProcessStatusStopping: EventProcessStopping,
+	ProcessStatusStopped:  EventProcessStopped,
+	ProcessStatusExited:   EventProcessExited,
+	ProcessStatusFatal:    EventProcessFatal,
+}
+
+const (
+	// eventBufferSize is how many events wait for a subscriber before new
+	// ones are dropped.
+	eventBufferSize = 64
+
+	// eventBacklogSize is how many of the last events are kept for
+	// FollowEvents.
+	eventBacklogSize = 256
+)
+
+// Event is something that happened to a process or to the service.
+type Event struct {
+	// Seq numbers the events of the service from 1, a gap means events were
+	// missed.
+	Seq        uint64     `json:"seq"`
+	Type       EventType  `json:"type"`
+	Level      slog.Level `json:"level"`
+	Time       time.Time  `json:"time"`
+	Process    string     `json:"process,omitempty"`
+	Task       string     `json:"task,omitempty"`
+	Message    string     `json:"message"`
+	Pid        int        `json:"pid,omitempty"`
+	ExitCode   int        `json:"exit_code,omitempty"`
+	ExitSignal string     `json:"exit_signal,omitempty"`
+
+	// The state the process left, and how many times it tried to start.
+	From  string `json:"from,omitempty"`
+	Tries int    `json:"tries,omitempty"`
+}
+
+// EventFilter selects events. Its zero value selects all of them.
+type EventFilter struct {
+
+	// The event types: starting, running, backoff, stopping, stopped,
+	// exited, fatal, limit, reload.
+	// Default: all of them.
+	Events []EventType `yaml:"events"`
+
+	// The minimum level of the events: debug, info, warn, error.
+	// Default: info.
+	Level slog.Level `yaml:"level"`
+
+	// Glob patterns of the task names. Events without a task, such as
+	// reload, always match.
+	// Default: all the tasks.
+	Tasks []string `yaml:"tasks"`
+}
+
+func (f EventFilter) match(e Event) bool {
+	if e.Level < f.Level {
+		return false
+	}
+	if len(f.Events) > 0 && !slices.Contains(f.Events, e.Type) {
+		return false
+	}
+	if len(f.Tasks) == 0 || e.Task == "" {
+		return true
+	}
+	for _, pattern := range f.Tasks {
+		if matched, _ := path.Match(pattern, e.Task); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (f EventFilter) check() error {
+	for _, typ := range f.Events {
+		if !slices.Contains(eventTypes, typ) {
+			return fmt.Errorf("unknown event: %s", typ)
+		}
+	}
+	for _, pattern := range f.Tasks {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid task pattern: %s", pattern)
+		}
+	}
+	return nil
+}
+
+// eventBus sends the events of the service to its subscribers, and keeps
+// the last ones.
+type eventBus struct {
+	mu      sync.Mutex
+	subs    map[chan Event]EventFilter
+	closed  bool
+	seq     uint64
+	backlog []Event
+	changed chan struct{}
+}
+
+func (b *eventBus) subscribe(filter EventFilter) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan Event, eventBufferSize)
+	if b.closed {
+		close(c)
+		return c, func() {}
+	}
+	if b.subs == nil {
+		b.subs = make(map[chan Event]EventFilter)
+	}
+	b.subs[c] = filter
+
+	return c, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, exists := b.subs[c]; exists {
+			delete(b.subs, c)
+			close(c)
+		}
+	}
+}
+
+// publish sends e to the subscribers it matches, without blocking.
+func (b *eventBus) publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e.Seq = b.seq
+	if len(b.backlog) == eventBacklogSize {
+		b.backlog = slices.Delete(b.backlog, 0, 1)
+	}
+	b.backlog = append(b.backlog, e)
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+
+	for c, filter := range b.subs {
+		if !filter.match(e) {
+			continue
+		}
+		select {
+		case c <- e:
+		default:
+			slog.Warn("event dropped",
+				slog.String("event", string(e.Type)),
+				slog.String("process", e.Process),
+			)
+		}
+	}
+}
+
+// since returns the kept events after seq matching filter, and the last
+// sequence number.
+func (b *eventBus) since(seq uint64, filter EventFilter) ([]Event, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var events []Event
+	for _, e := range b.backlog {
+		if e.Seq > seq && filter.match(e) {
+			events = append(events, e)
+		}
+	}
+	return events, b.seq
+}
+
+// wait blocks until an event after seq is published, or ctx is done.
+func (b *eventBus) wait(ctx context.Context, seq uint64) {
+	b.mu.Lock()
+	if b.seq > seq {
+		b.mu.Unlock()
+		return
+	}
+	if b.changed == nil {
+		b.changed = make(chan struct{})
+	}
+	changed := b.changed
+	b.mu.Unlock()
+
+	select {
+	case <-changed:
+	case <-ctx.Done():
+	}
+}
+
+// close ends all the subscriptions.
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for c := range b.subs {
+		close(c)
+	}
+	b.subs = nil
+	b.closed = true
+}
+
+// Subscribe returns the events of the service selected by filter, until
+// unsubscribe is called or the service is closed. Events are dropped when
+// the channel is full, so it should be read without delay.
+//
+// Parameters:
+//   - filter: which events to receive.
+//
+// Returns:
+//   - The events, and the function ending the subscription.
+func (s *Service) Subscribe(filter EventFilter) (events <-chan Event, unsubscribe func()) {
+	return s.events.subscribe(filter)
+}
+
+// EventsArgs are the arguments of the Events RPC.
+type EventsArgs struct {
+	Filter EventFilter
+
+	// Follow waits for the events after Seq instead of returning the last
+	// sequence number.
+	Follow bool
+	Seq    uint64
+}
+
+// EventsReply is the reply of the Events RPC.
+type EventsReply struct {
+	Events []Event
+
+	// The sequence number to follow the events from.
+	Seq uint64
+}
+
+// LastEvent returns the sequence number of the last event, to follow the
+// events from.
+func (s *Service) LastEvent() uint64 {
+	_, seq := s.events.since(math.MaxUint64, EventFilter{})
+	return seq
+}
+
+// FollowEvents waits for the events published after seq which match filter.
+// It returns with no events after a while, or once ctx is done. The last
+// events only are kept, a slow follower may miss some.
+//
+// Parameters:
+//   - seq: the value of LastEvent, or the one returned by the previous call.
+//   - filter: which events to return.
+//
+// Returns:
+//   - The events, and the sequence number to follow the events from.
+func (s *Service) FollowEvents(ctx context.Context, seq uint64, filter EventFilter) ([]Event, uint64) {
+	ctx, cancel := context.WithTimeout(ctx, followTimeout)
+	defer cancel()
+
+	for {
+		s.events.wait(ctx, seq)
+		events, last := s.events.since(seq, filter)
+		if len(events) > 0 || ctx.Err() != nil {
+			return events, last
+		}
+		seq = last
+	}
+}
+
+// WriteEvent writes an event on a line, as JSON if asJSON is true.
+func WriteEvent(w io.Writer, e Event, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(e)
+	}
+
+	name := e.Process
+	if name == "" {
+		name = "-"
+	}
+	_, err := fmt.Fprintf(w, "%s %5s %-8s %s: %s\n",
+		e.Time.Format("15:04:05.000"),
+		e.Level,
+		e.Type,
+		name,
+		e.Message,
+	)
+	return err
+}
+
+// stateEvent returns the event of the process entering status from the
+// state from. The caller holds p.mu.
+func (p *Process) stateEvent(from, status ProcessStatus, msg string) (Event, bool) {
+	typ, exists := stateEvents[status]
+	if !exists {
+		return Event{}, false
+	}
+
+	e := Event{
+		Type:    typ,
+		Level:   slog.LevelInfo,
+		Time:    time.Now(),
+		Process: p.name,
+		Task:    p.taskName,
+		Message: msg,
+		Pid:     p.pid,
+		From:    strings.ToLower(from.String()),
+	}
+	switch status {
+	case ProcessStatusStarting, ProcessStatusBackoff:
+		e.Tries = p.startCount
+	case ProcessStatusExited, ProcessStatusStopped:
+		e.ExitCode = p.exitCode
+		e.ExitSignal = p.exitSignal
+		if from != ProcessStatusBackoff {
+			// The child is already reaped.
+			e.Pid = p.exitPid
+		}
+	case ProcessStatusFatal:
+		e.Level = slog.LevelError
+	}
+	if status == ProcessStatusExited {
+		switch {
+		case p.exitSignal != "":
+			e.Level = slog.LevelWarn
+			e.Message = "killed by signal " + p.exitSignal
+		case !p.task.isExpectedExitCode(p.exitCode):
+			e.Level = slog.LevelWarn
+			e.Message = fmt.Sprintf("exited unexpectedly with code %d", p.exitCode)
+		default:
+			e.Message = fmt.Sprintf("exited with code %d", p.exitCode)
+		}
+	}
+	if e.Message == "" {
+		e.Message = string(typ)
+	}
+	return e, true
+}
+
+// emitReload sends the result of a reload.
+func (s *Service) emitReload(err error) {
+	e := Event{
+		Type:    EventConfigReloaded,
+		Level:   slog.LevelInfo,
+		Time:    time.Now(),
+		Message: "reload succesful",
+	}
+	if err != nil {
+		e.Level = slog.LevelError
+		e.Message = err.Error()
+	}
+	s.events.publish(e)
+}
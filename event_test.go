@@ -0,0 +1,129 @@
+package taskmaster
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event, or fails after a while.
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("Expected an event, the subscription ended")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected an event")
+	}
+	return Event{}
+}
+
+func TestService_Subscribe(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"web": {
+				Cmd:          "sleep",
+				Args:         []string{"10"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    50 * time.Millisecond,
+				StopTime:     time.Second,
+			},
+			"crasher": {
+				Cmd:          "sh",
+				Args:         []string{"-c", "sleep 0.1; exit 2"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    50 * time.Millisecond,
+				StopTime:     time.Second,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	events, unsubscribe := s.Subscribe(EventFilter{Tasks: []string{"web"}})
+	if err := s.StartWait("web"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Stop("web"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []EventType{EventProcessStarting, EventProcessRunning, EventProcessStopping, EventProcessStopped} {
+		if e := nextEvent(t, events); e.Type != want || e.Process != "web" {
+			t.Fatalf("Expected %s of web, got %s of %s", want, e.Type, e.Process)
+		}
+	}
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Error("Expected the channel to be closed once unsubscribed")
+	}
+
+	exits, _ := s.Subscribe(EventFilter{Events: []EventType{EventProcessExited}, Level: slog.LevelWarn})
+	s.Start("crasher")
+	e := nextEvent(t, exits)
+	if e.Process != "crasher" || e.ExitCode != 2 || e.Level != slog.LevelWarn {
+		t.Errorf("Expected an unexpected exit with code 2, got %+v", e)
+	}
+
+	s.Close()
+	if _, ok := <-exits; ok {
+		t.Error("Expected the subscriptions to end with the service")
+	}
+}
+
+func TestService_FollowEvents(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"web": {
+				Cmd:          "sleep",
+				Args:         []string{"10"},
+				NumProcs:     2,
+				StartRetries: 1,
+				StartTime:    50 * time.Millisecond,
+				StopTime:     time.Second,
+			},
+			"worker": {
+				Cmd:          "sleep",
+				Args:         []string{"10"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    50 * time.Millisecond,
+				StopTime:     time.Second,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	seq := s.LastEvent()
+	s.Start("worker")
+	s.Start("web_00")
+	s.Start("web_01")
+
+	filter := EventFilter{Events: []EventType{EventProcessRunning}, Tasks: []string{"w?b"}}
+	running := map[string]bool{}
+	for len(running) < 2 {
+		events, next := s.FollowEvents(context.Background(), seq, filter)
+		if len(events) == 0 {
+			t.Fatalf("Expected the web processes to run, got %v", running)
+		}
+		for _, e := range events {
+			if e.Task != "web" || e.Seq <= seq {
+				t.Errorf("Unexpected event %+v after %d", e, seq)
+			}
+			running[e.Process] = true
+		}
+		seq = next
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if events, next := s.FollowEvents(ctx, seq, filter); len(events) != 0 || next < seq {
+		t.Errorf("Expected no event once ctx is done, got %v (%d)", events, next)
+	}
+}
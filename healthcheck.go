@@ -0,0 +1,237 @@
+package taskmaster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	HealthCheckExec healthCheckType = "exec"
+	HealthCheckTCP  healthCheckType = "tcp"
+	HealthCheckHTTP healthCheckType = "http"
+	HealthCheckFile healthCheckType = "file"
+
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 5 * time.Second
+	defaultHealthRetries  = 3
+)
+
+type healthCheckType string
+
+//go:generate stringer --type HealthStatus --trimprefix HealthStatus
+type HealthStatus int
+
+const (
+	// The process has no health check, or no child.
+	HealthStatusNone HealthStatus = iota
+	// No probe succeeded yet.
+	HealthStatusStarting
+	// The last probe succeeded.
+	HealthStatusHealthy
+	// Retries probes failed in a row.
+	HealthStatusUnhealthy
+)
+
+// HealthCheck probes a running program to tell if it is healthy.
+type HealthCheck struct {
+
+	// The kind of probe: exec, tcp, http or file.
+	Type healthCheckType `yaml:"type"`
+
+	// exec: the command to run, healthy if it exits with 0.
+	Cmd  string   `yaml:"cmd"`
+	Args []string `yaml:"args"`
+
+	// tcp: the local port to connect to.
+	Port int `yaml:"port"`
+
+	// http: the url to GET, healthy on a 2xx response.
+	URL string `yaml:"url"`
+
+	// file: the heartbeat file, healthy if modified within MaxAge.
+	Path   string        `yaml:"path"`
+	MaxAge time.Duration `yaml:"maxage"`
+
+	// How often to probe.
+	// Default: 30s.
+	Interval time.Duration `yaml:"interval"`
+
+	// How long a probe can take before being a failure.
+	// Default: 5s.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// How many failures in a row make the program unhealthy.
+	// Default: 3.
+	Retries int `yaml:"retries"`
+
+	// How long after a start failures are not counted.
+	StartPeriod time.Duration `yaml:"startperiod"`
+
+	// How many failures in a row make the program restarted.
+	// Default: 0, never restart.
+	RestartAfter int `yaml:"restartafter"`
+}
+
+// init checks the health check of task name and sets its defaults.
+func (hc *HealthCheck) init(name string) error {
+	switch hc.Type {
+	case HealthCheckExec:
+		if hc.Cmd == "" {
+			return fmt.Errorf("config: task %s: exec healthcheck needs a cmd", name)
+		}
+	case HealthCheckTCP:
+		if hc.Port <= 0 || hc.Port > 65535 {
+			return fmt.Errorf("config: task %s: tcp healthcheck needs a valid port", name)
+		}
+	case HealthCheckHTTP:
+		if hc.URL == "" {
+			return fmt.Errorf("config: task %s: http healthcheck needs an url", name)
+		}
+	case HealthCheckFile:
+		if hc.Path == "" || hc.MaxAge <= 0 {
+			return fmt.Errorf("config: task %s: file healthcheck needs a path and a maxage", name)
+		}
+	default:
+		return fmt.Errorf("config: task %s: unknown healthcheck type: %s", name, hc.Type)
+	}
+
+	if hc.Interval <= time.Duration(0) {
+		hc.Interval = defaultHealthInterval
+	}
+	if hc.Timeout <= time.Duration(0) {
+		hc.Timeout = defaultHealthTimeout
+	}
+	if hc.Retries <= 0 {
+		hc.Retries = defaultHealthRetries
+	}
+	return nil
+}
+
+// probe runs the check once, returning nil if healthy.
+func (hc HealthCheck) probe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.Timeout)
+	defer cancel()
+
+	switch hc.Type {
+	case HealthCheckExec:
+		return exec.CommandContext(ctx, hc.Cmd, hc.Args...).Run()
+
+	case HealthCheckTCP:
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(hc.Port)))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case HealthCheckHTTP:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.URL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected http status: %s", resp.Status)
+		}
+		return nil
+
+	case HealthCheckFile:
+		info, err := os.Stat(hc.Path)
+		if err != nil {
+			return err
+		}
+		if age := time.Since(info.ModTime()); age > hc.MaxAge {
+			return fmt.Errorf("heartbeat file is %s old", age.Truncate(time.Second))
+		}
+		return nil
+
+	default:
+		return errors.New("unknown healthcheck type")
+	}
+}
+
+// healthLoop probes the child every Interval and sends the results until ctx
+// is done.
+func (hc HealthCheck) healthLoop(ctx context.Context, results chan<- error) {
+	ticker := time.NewTicker(hc.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := hc.probe(ctx)
+		select {
+		case results <- err:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleHealth updates the health of the process from a probe result, and
+// restarts it after RestartAfter failures in a row.
+func (p *Process) handleHealth(err error) {
+	hc := p.task.HealthCheck
+
+	p.mu.Lock()
+	inStartPeriod := time.Since(p.startAt) < hc.StartPeriod
+	p.mu.Unlock()
+
+	if err == nil {
+		p.healthFailures = 0
+		p.setHealth(HealthStatusHealthy)
+		return
+	}
+	if inStartPeriod {
+		return
+	}
+
+	p.healthFailures++
+	slog.Warn("health check failed",
+		slog.String("process", p.name),
+		slog.Int("failures", p.healthFailures),
+		slog.Any("error", err),
+	)
+	if p.healthFailures >= hc.Retries {
+		p.setHealth(HealthStatusUnhealthy)
+	}
+	if hc.RestartAfter > 0 && p.healthFailures >= hc.RestartAfter {
+		p.healthFailures = 0
+		p.restart("unhealthy")
+	}
+}
+
+// Health returns the current health of the process.
+func (p *Process) Health() HealthStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.health
+}
+
+func (p *Process) setHealth(health HealthStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.health == health {
+		return
+	}
+	p.health = health
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
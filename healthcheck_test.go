@@ -0,0 +1,102 @@
+package taskmaster
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckProbe(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	heartbeat := filepath.Join(t.TempDir(), "heartbeat")
+	if err := os.WriteFile(heartbeat, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		hc      HealthCheck
+		healthy bool
+	}{
+		{"exec ok", HealthCheck{Type: HealthCheckExec, Cmd: "true"}, true},
+		{"exec ko", HealthCheck{Type: HealthCheckExec, Cmd: "false"}, false},
+		{"tcp ok", HealthCheck{Type: HealthCheckTCP, Port: lis.Addr().(*net.TCPAddr).Port}, true},
+		{"http ok", HealthCheck{Type: HealthCheckHTTP, URL: srv.URL + "/health"}, true},
+		{"http ko", HealthCheck{Type: HealthCheckHTTP, URL: srv.URL + "/down"}, false},
+		{"file ok", HealthCheck{Type: HealthCheckFile, Path: heartbeat, MaxAge: time.Minute}, true},
+		{"file missing", HealthCheck{Type: HealthCheckFile, Path: heartbeat + ".nope", MaxAge: time.Minute}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.hc.init("test"); err != nil {
+			t.Fatalf("%s: init: %v", tt.name, err)
+		}
+		err := tt.hc.probe(context.Background())
+		if healthy := err == nil; healthy != tt.healthy {
+			t.Errorf("%s: expected healthy %v, got error %v", tt.name, tt.healthy, err)
+		}
+	}
+}
+
+func TestService_RestartOnUnhealthy(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"wedged": {
+				Cmd:          "sleep",
+				Args:         []string{"10"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    time.Millisecond * 10,
+				StopTime:     time.Second,
+				HealthCheck: &HealthCheck{
+					Type:         HealthCheckExec,
+					Cmd:          "false",
+					Interval:     time.Millisecond * 20,
+					Timeout:      time.Second,
+					Retries:      1,
+					RestartAfter: 2,
+				},
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if err := s.StartWait("wedged"); err != nil {
+		t.Fatalf("Expected StartWait to succeed, got %v", err)
+	}
+
+	process := s.processes["wedged"]
+	ctx, cancel := context.WithTimeout(s.Ctx, 5*time.Second)
+	defer cancel()
+	_, health := process.waitFor(ctx, func(_ ProcessStatus, health HealthStatus) bool {
+		return health == HealthStatusUnhealthy
+	})
+	if health != HealthStatusUnhealthy {
+		t.Fatalf("Expected process to be Unhealthy, got %s", health)
+	}
+
+	process.waitFor(ctx, func(ProcessStatus, HealthStatus) bool {
+		return process.Info().StartCount >= 2
+	})
+	if info := process.Info(); info.StartCount < 2 {
+		t.Errorf("Expected process to be restarted, got %d spawns", info.StartCount)
+	}
+}
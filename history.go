@@ -0,0 +1,188 @@
+package taskmaster
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// historySize is how many runs are kept per task.
+	historySize = 20
+
+	// outputTailSize is how many bytes of output are kept per run.
+	outputTailSize = 4096
+)
+
+// JobRun is a finished run of a program running to completion.
+type JobRun struct {
+	Process    string
+	Task       string
+	Start      time.Time
+	End        time.Time
+	Duration   time.Duration
+	ExitCode   int
+	ExitSignal string
+	Success    bool
+
+	// The last bytes written by the program on stdout and stderr.
+	Output string
+}
+
+// runHistory keeps the last runs of each task.
+type runHistory struct {
+	mu   sync.Mutex
+	runs map[string][]JobRun
+}
+
+func (h *runHistory) add(run JobRun) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.runs == nil {
+		h.runs = make(map[string][]JobRun)
+	}
+	runs := append(h.runs[run.Task], run)
+	if len(runs) > historySize {
+		runs = slices.Delete(runs, 0, len(runs)-historySize)
+	}
+	h.runs[run.Task] = runs
+}
+
+// get returns the runs of a task, oldest first.
+func (h *runHistory) get(taskName string) []JobRun {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.runs[taskName])
+}
+
+// Run starts a process running to completion, or all the processes of a
+// task, and waits for them to finish.
+//
+// Parameters:
+//   - name: the name of the process, or of the task.
+//
+// Returns:
+//   - The finished runs sorted by process, each successful if its program
+//     exited with one of its task ExitCodes.
+func (s *Service) Run(name string) ([]JobRun, error) {
+	processes, err := s.jobProcesses(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, process := range processes {
+		if !process.task.runsToCompletion() {
+			return nil, ErrProcessNotJob
+		}
+	}
+
+	runs := make([]JobRun, len(processes))
+	errs := make([]error, len(processes))
+	var wg sync.WaitGroup
+	wg.Add(len(processes))
+	for i, process := range processes {
+		go func() {
+			defer wg.Done()
+			runs[i], errs[i] = s.runProcess(process)
+			if errs[i] != nil && len(processes) > 1 {
+				errs[i] = fmt.Errorf("%s: %w", process.name, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// jobProcesses returns the process called name, or else the processes of the
+// task called name, sorted by name.
+func (s *Service) jobProcesses(name string) ([]*Process, error) {
+	process, err := s.process(name)
+	if err == nil {
+		return []*Process{process}, nil
+	}
+	if !errors.Is(err, ErrProcessUnknown) {
+		return nil, err
+	}
+
+	var processes []*Process
+	for _, process := range s.taskProcesses(name) {
+		if !process.extra {
+			processes = append(processes, process)
+		}
+	}
+	if len(processes) == 0 {
+		return nil, ErrProcessUnknown
+	}
+	slices.SortFunc(processes, func(a, b *Process) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return processes, nil
+}
+
+// runProcess starts a process running to completion and waits for its run.
+func (s *Service) runProcess(process *Process) (JobRun, error) {
+	if err := process.send(requestStart); err != nil {
+		return JobRun{}, err
+	}
+
+	switch process.wait(s.Ctx,
+		ProcessStatusExited,
+		ProcessStatusStopped,
+		ProcessStatusFatal,
+	) {
+	case ProcessStatusExited, ProcessStatusStopped:
+		return process.LastRun(), nil
+	case ProcessStatusFatal:
+		return JobRun{}, ErrProcessStartFailed
+	default:
+		return JobRun{}, ErrProcessIsNotRunning
+	}
+}
+
+// History returns the last runs of a task, oldest first.
+//
+// Parameters:
+//   - taskName: the name of the task.
+func (s *Service) History(taskName string) ([]JobRun, error) {
+	s.mu.Lock()
+	_, exists := s.cfg.Tasks[taskName]
+	s.mu.Unlock()
+	if !exists {
+		return nil, ErrTaskUnknown
+	}
+
+	return s.history.get(taskName), nil
+}
+
+// WriteRunTable writes runs as a table to w.
+func WriteRunTable(w io.Writer, runs []JobRun) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROCESS\tSTART\tDURATION\tEXIT\tRESULT")
+	for _, run := range runs {
+		exit := fmt.Sprint(run.ExitCode)
+		if run.ExitSignal != "" {
+			exit = run.ExitSignal
+		}
+		result := "failed"
+		if run.Success {
+			result = "ok"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			run.Process,
+			run.Start.Format(time.DateTime),
+			run.Duration,
+			exit,
+			result,
+		)
+	}
+	return tw.Flush()
+}
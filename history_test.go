@@ -0,0 +1,111 @@
+package taskmaster
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHistoryIsBounded(t *testing.T) {
+	var h runHistory
+	for i := range historySize + 5 {
+		h.add(JobRun{Task: "job", ExitCode: i})
+	}
+
+	runs := h.get("job")
+	if len(runs) != historySize {
+		t.Fatalf("Expected %d runs, got %d", historySize, len(runs))
+	}
+	if runs[0].ExitCode != 5 || runs[len(runs)-1].ExitCode != historySize+4 {
+		t.Errorf("Expected the oldest runs to be dropped, got %d to %d", runs[0].ExitCode, runs[len(runs)-1].ExitCode)
+	}
+}
+
+func TestService_RunOneshot(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"migrate": {
+				Type:         TaskTypeOneshot,
+				Cmd:          "sh",
+				Args:         []string{"-c", "echo migrating; echo oops >&2; exit 3"},
+				NumProcs:     1,
+				ExitCodes:    []int{0},
+				StartRetries: 1,
+				StartTime:    time.Second,
+				StopTime:     time.Second,
+			},
+			"server": {
+				Cmd:          "sleep",
+				Args:         []string{"10"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    time.Second,
+				StopTime:     time.Second,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	runs, err := s.Run("migrate")
+	if err != nil {
+		t.Fatalf("Expected Run to succeed, got %v", err)
+	}
+	run := runs[0]
+	if run.ExitCode != 3 || run.Success {
+		t.Errorf("Expected a failed run with exit code 3, got %d (success %v)", run.ExitCode, run.Success)
+	}
+	if !strings.Contains(run.Output, "migrating") || !strings.Contains(run.Output, "oops") {
+		t.Errorf("Expected the output tail, got %q", run.Output)
+	}
+	if status := s.Status("migrate"); status != ProcessStatusExited {
+		t.Errorf("Expected the job not to be restarted, got %s", status)
+	}
+
+	runs, err = s.History("migrate")
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("Expected 1 run in history, got %d (%v)", len(runs), err)
+	}
+
+	if _, err := s.Run("server"); !errors.Is(err, ErrProcessNotJob) {
+		t.Errorf("Expected ErrProcessNotJob, got %v", err)
+	}
+	if _, err := s.History("unknown"); !errors.Is(err, ErrTaskUnknown) {
+		t.Errorf("Expected ErrTaskUnknown, got %v", err)
+	}
+}
+
+func TestService_RunTask(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"warm": {
+				Type:         TaskTypeOneshot,
+				Cmd:          "sh",
+				Args:         []string{"-c", `[ "$0" = warm_00 ]`},
+				NumProcs:     2,
+				StartRetries: 1,
+				StartTime:    time.Second,
+				StopTime:     time.Second,
+				ExitCodes:    []int{0},
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	runs, err := s.Run("warm")
+	if err != nil {
+		t.Fatalf("Expected Run to succeed, got %v", err)
+	}
+	if len(runs) != 2 || runs[0].Process != "warm_00" || runs[1].Process != "warm_01" {
+		t.Fatalf("Expected the runs of both processes, got %+v", runs)
+	}
+	if !runs[0].Success || runs[1].Success || runs[1].ExitCode != 1 {
+		t.Errorf("Expected warm_01 only to fail, got %+v", runs)
+	}
+
+	if _, err := s.Run("unknown"); !errors.Is(err, ErrProcessUnknown) {
+		t.Errorf("Expected ErrProcessUnknown, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package taskmaster
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	LimitActionLog     limitAction = "log"
+	LimitActionNotify  limitAction = "notify"
+	LimitActionSignal  limitAction = "signal"
+	LimitActionRestart limitAction = "restart"
+)
+
+type limitAction string
+
+// The resource limits of a task.
+const (
+	limitMemory = "memory"
+	limitCPU    = "cpu"
+	limitFDs    = "fds"
+)
+
+// CPULimit is a CPU usage threshold, read from yaml as a percentage,
+// optionally followed by how long the usage must stay above it: 90 or
+// "90 for 2m".
+type CPULimit struct {
+	Percent float64
+	For     time.Duration
+}
+
+func (c *CPULimit) UnmarshalYAML(node *yaml.Node) error {
+	percent, duration, found := strings.Cut(strings.TrimSpace(node.Value), " for ")
+
+	p, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(percent), "%"), 64)
+	if err != nil || p < 0 {
+		return fmt.Errorf("invalid cpu limit: %s", node.Value)
+	}
+	var d time.Duration
+	if found {
+		d, err = time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid cpu limit duration: %s", node.Value)
+		}
+	}
+	*c = CPULimit{Percent: p, For: d}
+	return nil
+}
+
+// hasLimits returns true if the task has a resource limit.
+func (t Task) hasLimits() bool {
+	return t.MemoryLimit > 0 || t.CPULimit.Percent > 0 || t.MaxFDs > 0
+}
+
+// checkLimits verifies the resource limits of task name.
+func (t *Task) checkLimits(name string) error {
+	if t.MaxFDs < 0 {
+		return fmt.Errorf("config: negative max_fds: task %s has %d", name, t.MaxFDs)
+	}
+
+	switch t.LimitAction {
+	case "":
+		t.LimitAction = LimitActionRestart
+	case LimitActionLog, LimitActionNotify, LimitActionRestart:
+	case LimitActionSignal:
+		if _, ok := parseSignal(t.LimitSignal); !ok || t.LimitSignal == "" {
+			return fmt.Errorf("config: task %s: unsupported limit signal: %s", name, t.LimitSignal)
+		}
+	default:
+		return fmt.Errorf("config: task %s: unknown limit action: %s", name, t.LimitAction)
+	}
+	return nil
+}
+
+// limitWatch tracks the limits each process crossed, so that an action is
+// taken once per crossing.
+type limitWatch struct {
+	mu     sync.Mutex
+	states map[string]*limitState
+}
+
+type limitState struct {
+	pid int
+
+	// When the CPU usage went above the limit, zero if it is below.
+	cpuSince time.Time
+
+	// The limits crossed, until the usage goes back below them.
+	crossed map[string]bool
+}
+
+// crossings returns the limits of task newly crossed by the sample st of
+// process name, with a description of each.
+func (w *limitWatch) crossings(name string, task *Task, st ProcessStats) map[string]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.states == nil {
+		w.states = make(map[string]*limitState)
+	}
+	state, exists := w.states[name]
+	if !exists || state.pid != st.Pid {
+		state = &limitState{pid: st.Pid, crossed: make(map[string]bool)}
+		w.states[name] = state
+	}
+
+	above := make(map[string]string)
+	if task.MemoryLimit > 0 && ByteSize(st.RSS) > task.MemoryLimit {
+		above[limitMemory] = fmt.Sprintf("memory %s above %s", ByteSize(st.RSS), task.MemoryLimit)
+	}
+	if task.MaxFDs > 0 && st.FDs > task.MaxFDs {
+		above[limitFDs] = fmt.Sprintf("%d open files above %d", st.FDs, task.MaxFDs)
+	}
+	if limit := task.CPULimit; limit.Percent > 0 && st.CPU > limit.Percent {
+		if state.cpuSince.IsZero() {
+			state.cpuSince = st.Time
+		}
+		if st.Time.Sub(state.cpuSince) >= limit.For {
+			above[limitCPU] = fmt.Sprintf("cpu %.1f%% above %g%%", st.CPU, limit.Percent)
+			if limit.For > 0 {
+				above[limitCPU] += " for " + limit.For.String()
+			}
+		}
+	} else {
+		state.cpuSince = time.Time{}
+	}
+
+	crossings := make(map[string]string)
+	for limit, desc := range above {
+		if !state.crossed[limit] {
+			state.crossed[limit] = true
+			crossings[limit] = desc
+		}
+	}
+	for limit := range state.crossed {
+		if _, exists := above[limit]; !exists {
+			delete(state.crossed, limit)
+		}
+	}
+	return crossings
+}
+
+// prune forgets the processes which are gone.
+func (w *limitWatch) prune(processes map[string]*Process) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for name := range w.states {
+		if _, exists := processes[name]; !exists {
+			delete(w.states, name)
+		}
+	}
+}
+
+// checkLimits takes the limit action of task if the sample st of process
+// newly crossed some of its limits.
+func (s *Service) checkLimits(process *Process, task *Task, st ProcessStats) {
+	if !task.hasLimits() {
+		return
+	}
+	crossings := s.limits.crossings(process.name, task, st)
+	if len(crossings) == 0 {
+		return
+	}
+
+	limits := slices.Sorted(maps.Keys(crossings))
+	descs := make([]string, 0, len(limits))
+	for _, limit := range limits {
+		descs = append(descs, crossings[limit])
+	}
+	desc := strings.Join(descs, ", ")
+	slog.Warn("limit crossed",
+		slog.String("process", process.name),
+		slog.String("usage", desc),
+		slog.String("action", string(task.LimitAction)),
+	)
+
+	var err error
+	switch task.LimitAction {
+	case LimitActionNotify:
+		s.events.publish(Event{
+			Type:    EventProcessLimit,
+			Level:   slog.LevelWarn,
+			Time:    st.Time,
+			Process: process.name,
+			Task:    process.taskName,
+			Message: desc,
+			Pid:     st.Pid,
+		})
+	case LimitActionSignal:
+		sig, _ := parseSignal(task.LimitSignal)
+		err = process.sendRequest(request{kind: requestSignal, signal: sig})
+	case LimitActionRestart:
+		err = process.sendRequest(request{kind: requestRestart, reason: desc})
+	}
+	if err != nil {
+		slog.Error("limit action failed",
+			slog.String("process", process.name),
+			slog.String("action", string(task.LimitAction)),
+			slog.Any("error", err),
+		)
+	}
+}
@@ -0,0 +1,200 @@
+package taskmaster
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCPULimit_UnmarshalYAML(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want CPULimit
+		ok   bool
+	}{
+		{`90`, CPULimit{Percent: 90}, true},
+		{`"150%"`, CPULimit{Percent: 150}, true},
+		{`"90 for 2m"`, CPULimit{Percent: 90, For: 2 * time.Minute}, true},
+		{`"90 for ever"`, CPULimit{}, false},
+		{`lots`, CPULimit{}, false},
+	} {
+		var got CPULimit
+		err := yaml.Unmarshal([]byte(tc.in), &got)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: unexpected error: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %+v, got %+v", tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestConfig_Limits(t *testing.T) {
+	for _, tc := range []struct {
+		task Task
+		ok   bool
+	}{
+		{Task{}, true},
+		{Task{LimitAction: LimitActionNotify}, true},
+		{Task{LimitAction: LimitActionSignal, LimitSignal: "USR1"}, true},
+		{Task{LimitAction: LimitActionSignal}, false},
+		{Task{LimitAction: LimitActionSignal, LimitSignal: "NOPE"}, false},
+		{Task{LimitAction: "kill"}, false},
+		{Task{MaxFDs: -1}, false},
+	} {
+		err := tc.task.checkLimits("web")
+		if (err == nil) != tc.ok {
+			t.Errorf("%+v: unexpected error: %v", tc.task, err)
+		}
+	}
+
+	task := Task{}
+	if err := task.checkLimits("web"); err != nil || task.LimitAction != LimitActionRestart {
+		t.Errorf("Expected the restart action by default, got %q", task.LimitAction)
+	}
+}
+
+func TestLimitWatch_Crossings(t *testing.T) {
+	var w limitWatch
+	task := &Task{MemoryLimit: 1024, CPULimit: CPULimit{Percent: 50, For: time.Minute}}
+	now := time.Now()
+
+	st := ProcessStats{Time: now, Pid: 42, RSS: 2048, CPU: 80}
+	if got := w.crossings("web", task, st); len(got) != 1 || got[limitMemory] == "" {
+		t.Fatalf("Expected the memory limit to be crossed, got %v", got)
+	}
+	// A limit still crossed is not reported again.
+	st.Time = now.Add(time.Minute)
+	if got := w.crossings("web", task, st); len(got) != 1 || got[limitCPU] == "" {
+		t.Fatalf("Expected the cpu limit to be crossed after a minute, got %v", got)
+	}
+	// Nor one crossed again before the usage went below it.
+	st.Time = now.Add(2 * time.Minute)
+	if got := w.crossings("web", task, st); len(got) != 0 {
+		t.Fatalf("Expected no new crossing, got %v", got)
+	}
+	// A new child starts afresh.
+	st.Pid = 43
+	if got := w.crossings("web", task, st); len(got) != 1 || got[limitMemory] == "" {
+		t.Fatalf("Expected the memory limit of the new child to be crossed, got %v", got)
+	}
+}
+
+func TestService_LimitNotify(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"web": {
+				Cmd:          "sleep",
+				Args:         []string{"10"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    50 * time.Millisecond,
+				StopTime:     time.Second,
+				MemoryLimit:  1024,
+				LimitAction:  LimitActionNotify,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	events, unsubscribe := s.Subscribe(EventFilter{Events: []EventType{EventProcessLimit}})
+	defer unsubscribe()
+	if err := s.StartWait("web"); err != nil {
+		t.Fatal(err)
+	}
+	s.sampleStats(time.Now())
+	if e := nextEvent(t, events); e.Process != "web" || e.Pid == 0 {
+		t.Fatalf("Expected the limit event of web, got %+v", e)
+	}
+}
+
+func TestService_LimitRestart(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"web": {
+				Cmd:          "sleep",
+				Args:         []string{"10"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    50 * time.Millisecond,
+				StopTime:     time.Second,
+				MemoryLimit:  1024,
+				LimitAction:  LimitActionRestart,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if err := s.StartWait("web"); err != nil {
+		t.Fatal(err)
+	}
+	s.sampleStats(time.Now())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := s.Info("web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.StartCount == 2 && info.State == ProcessStatusRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected web to be restarted, got %+v", info)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestService_ReloadLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	defer func(previous []string) { paths = previous }(paths)
+	paths = []string{path}
+
+	config := `
+tasks:
+  web:
+    cmd: sleep
+    args: ["10"]
+    starttime: 50ms
+    stoptime: 1s
+    limit_action: notify
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var cfg Config
+	if err := cfg.Load(); err != nil {
+		t.Fatal(err)
+	}
+	s := New(&cfg)
+	defer s.Close()
+
+	events, unsubscribe := s.Subscribe(EventFilter{Events: []EventType{EventProcessLimit}})
+	defer unsubscribe()
+	if err := s.StartWait("web"); err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := s.GetPid("web")
+
+	if err := os.WriteFile(path, []byte(config+"    memory_limit: 1KiB\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := s.Reload(); !changed || err != nil {
+		t.Fatalf("Expected the config to change, got %v", err)
+	}
+	if newPid, _ := s.GetPid("web"); newPid != pid {
+		t.Fatalf("Expected web to keep running, got pid %d instead of %d", newPid, pid)
+	}
+
+	s.sampleStats(time.Now())
+	if e := nextEvent(t, events); e.Process != "web" || e.Pid != pid {
+		t.Fatalf("Expected the limit event of web, got %+v", e)
+	}
+}
@@ -0,0 +1,480 @@
+package taskmaster
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// The supervisord events an eventlistener can subscribe to, besides the
+	// PROCESS_STATE_* and TICK_* ones.
+	ListenerEventAll          = "EVENT"
+	ListenerEventProcessState = "PROCESS_STATE"
+
+	defaultListenerBufferSize = 10
+
+	listenerProtocolVersion = "3.0"
+	listenerReady           = "READY"
+	listenerResultOK        = "OK"
+	listenerResultFail      = "FAIL"
+
+	// The longest RESULT body a listener may send.
+	listenerMaxResult = 1024
+)
+
+var listenerTicks = map[string]time.Duration{
+	"TICK_5":    5 * time.Second,
+	"TICK_60":   time.Minute,
+	"TICK_3600": time.Hour,
+}
+
+// listenerSerials numbers the events sent to all the listeners, as the
+// serial of supervisord.
+var listenerSerials atomic.Uint64
+
+var errListenerProtocol = errors.New("listener: protocol error")
+
+// listenerStateName returns the supervisord name of a state event.
+func listenerStateName(typ EventType) string {
+	return ListenerEventProcessState + "_" + strings.ToUpper(string(typ))
+}
+
+// listenerSubscription returns the event types and the tick intervals
+// selected by the supervisord event names.
+func listenerSubscription(names []string) (types []EventType, ticks []time.Duration, err error) {
+	addType := func(typ EventType) {
+		if !slices.Contains(types, typ) {
+			types = append(types, typ)
+		}
+	}
+	addTick := func(d time.Duration) {
+		if !slices.Contains(ticks, d) {
+			ticks = append(ticks, d)
+		}
+	}
+
+	for _, name := range names {
+		switch {
+		case name == ListenerEventAll || name == ListenerEventProcessState:
+			for _, typ := range stateEvents {
+				addType(typ)
+			}
+			if name == ListenerEventAll {
+				for _, d := range listenerTicks {
+					addTick(d)
+				}
+			}
+		case listenerTicks[name] > 0:
+			addTick(listenerTicks[name])
+		default:
+			known := false
+			for _, typ := range stateEvents {
+				if name == listenerStateName(typ) {
+					addType(typ)
+					known = true
+				}
+			}
+			if !known {
+				return nil, nil, fmt.Errorf("unknown event: %s", name)
+			}
+		}
+	}
+	return types, ticks, nil
+}
+
+// checkListener verifies the settings of task name as an eventlistener.
+func (t *Task) checkListener(name string) error {
+	if t.Type != TaskTypeEventListener {
+		if len(t.Events) > 0 {
+			return fmt.Errorf("config: task %s has events but isn't an eventlistener", name)
+		}
+		return nil
+	}
+
+	if len(t.Events) == 0 {
+		return fmt.Errorf("config: task %s: eventlistener without events", name)
+	}
+	if _, _, err := listenerSubscription(t.Events); err != nil {
+		return fmt.Errorf("config: task %s: %w", name, err)
+	}
+	if t.Stdout != "" || t.RedirectStderr {
+		return fmt.Errorf("config: task %s: the standard output of an eventlistener can't be redirected", name)
+	}
+	if t.Schedule != "" {
+		return fmt.Errorf("config: task %s: an eventlistener can't be scheduled", name)
+	}
+	if t.BufferSize < 0 {
+		return fmt.Errorf("config: negative buffer_size: task %s has %d", name, t.BufferSize)
+	}
+	if t.BufferSize == 0 {
+		t.BufferSize = defaultListenerBufferSize
+	}
+	return nil
+}
+
+// listenerEvent is a serialized event waiting for a listener.
+type listenerEvent struct {
+	serial     uint64
+	poolSerial uint64
+	name       string
+	payload    string
+
+	// Whether a child of the pool is being sent the event.
+	sending bool
+}
+
+// eventListener buffers the events an eventlistener task subscribed to, and
+// feeds each of them to one of the children of its processes, the first one
+// ready. An event stays buffered until a child acknowledges it, so it is sent
+// again after a FAIL or a crash. When the buffer is full, the oldest event is
+// dropped.
+type eventListener struct {
+	pool        string
+	events      []string
+	bufferSize  int
+	unsubscribe func()
+	done        chan struct{}
+	closeOnce   sync.Once
+
+	mu         sync.Mutex
+	buffer     []listenerEvent
+	poolSerial uint64
+	changed    chan struct{}
+}
+
+// newEventListener subscribes to the events of the eventlistener task, pool
+// being its name.
+func newEventListener(pool string, task *Task, subscribe func(EventFilter) (<-chan Event, func())) *eventListener {
+	l := &eventListener{
+		pool:        pool,
+		events:      task.Events,
+		bufferSize:  task.BufferSize,
+		unsubscribe: func() {},
+		done:        make(chan struct{}),
+		changed:     make(chan struct{}),
+	}
+	if l.bufferSize <= 0 {
+		l.bufferSize = defaultListenerBufferSize
+	}
+
+	types, ticks, _ := listenerSubscription(task.Events)
+	if len(types) > 0 {
+		var events <-chan Event
+		events, l.unsubscribe = subscribe(EventFilter{Events: types})
+		go l.collect(events)
+	}
+	for _, d := range ticks {
+		go l.tick(d)
+	}
+
+	return l
+}
+
+// close ends the subscriptions of the listener.
+func (l *eventListener) close() {
+	l.closeOnce.Do(func() {
+		l.unsubscribe()
+		close(l.done)
+	})
+}
+
+func (l *eventListener) collect(events <-chan Event) {
+	for e := range events {
+		l.push(listenerStateName(e.Type), listenerStatePayload(e))
+	}
+}
+
+func (l *eventListener) tick(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	name := "TICK_" + strconv.Itoa(int(d.Seconds()))
+	for {
+		select {
+		case now := <-ticker.C:
+			l.push(name, fmt.Sprintf("when:%d", now.Unix()))
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// listenerStatePayload serializes a state event as supervisord does.
+func listenerStatePayload(e Event) string {
+	from := strings.ToUpper(e.From)
+	if e.From == strings.ToLower(ProcessStatusIdle.String()) {
+		// supervisord processes start from STOPPED.
+		from = strings.ToUpper(ProcessStatusStopped.String())
+	}
+	payload := fmt.Sprintf("processname:%s groupname:%s from_state:%s", e.Process, e.Task, from)
+
+	switch e.Type {
+	case EventProcessStarting, EventProcessBackoff:
+		payload += fmt.Sprintf(" tries:%d", e.Tries)
+	case EventProcessRunning, EventProcessStopping, EventProcessStopped:
+		payload += fmt.Sprintf(" pid:%d", e.Pid)
+	case EventProcessExited:
+		// Unexpected exits are the ones warned about.
+		expected := 0
+		if e.Level < slog.LevelWarn {
+			expected = 1
+		}
+		payload += fmt.Sprintf(" expected:%d pid:%d", expected, e.Pid)
+	}
+	return payload
+}
+
+// push buffers an event, dropping the oldest one if the buffer is full.
+func (l *eventListener) push(name, payload string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buffer) == l.bufferSize {
+		slog.Warn("listener buffer overflowed, event dropped",
+			slog.String("pool", l.pool),
+			slog.String("event", l.buffer[0].name),
+			slog.Uint64("serial", l.buffer[0].serial),
+		)
+		l.buffer = slices.Delete(l.buffer, 0, 1)
+	}
+	l.poolSerial++
+	l.buffer = append(l.buffer, listenerEvent{
+		serial:     listenerSerials.Add(1),
+		poolSerial: l.poolSerial,
+		name:       name,
+		payload:    payload,
+	})
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// next waits for the oldest buffered event not being sent to another child,
+// and marks it as being sent. It returns false once ctx is done.
+func (l *eventListener) next(ctx context.Context) (listenerEvent, bool) {
+	for {
+		l.mu.Lock()
+		for i := range l.buffer {
+			if !l.buffer[i].sending {
+				l.buffer[i].sending = true
+				e := l.buffer[i]
+				l.mu.Unlock()
+				return e, true
+			}
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return listenerEvent{}, false
+		}
+	}
+}
+
+// ack removes an acknowledged event from the buffer, unless it was already
+// dropped.
+func (l *eventListener) ack(serial uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buffer = slices.DeleteFunc(l.buffer, func(e listenerEvent) bool {
+		return e.serial == serial
+	})
+}
+
+// release makes an event that wasn't acknowledged available to the children
+// of the pool again.
+func (l *eventListener) release(serial uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := range l.buffer {
+		if l.buffer[i].serial == serial {
+			l.buffer[i].sending = false
+		}
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// serve speaks the supervisord eventlistener protocol with a child, until
+// ctx is done or the child exits.
+func (l *eventListener) serve(ctx context.Context, name string, stdin io.Writer, stdout io.Reader) {
+	r := bufio.NewReader(stdout)
+	for {
+		if err := l.waitReady(r, name); err != nil {
+			return
+		}
+		e, ok := l.next(ctx)
+		if !ok {
+			return
+		}
+
+		header := fmt.Sprintf("ver:%s server:taskmaster serial:%d pool:%s poolserial:%d eventname:%s len:%d\n",
+			listenerProtocolVersion,
+			e.serial,
+			l.pool,
+			e.poolSerial,
+			e.name,
+			len(e.payload),
+		)
+		if _, err := io.WriteString(stdin, header+e.payload); err != nil {
+			l.release(e.serial)
+			return
+		}
+
+		ok, err := readResult(r)
+		if err != nil {
+			l.release(e.serial)
+			if ctx.Err() == nil {
+				slog.Error("listener stopped being fed",
+					slog.String("process", name),
+					slog.Any("error", err),
+				)
+			}
+			return
+		}
+		if !ok {
+			slog.Warn("listener rejected event",
+				slog.String("process", name),
+				slog.String("event", e.name),
+				slog.Uint64("serial", e.serial),
+			)
+			l.release(e.serial)
+			continue
+		}
+		l.ack(e.serial)
+	}
+}
+
+// waitReady reads the output of a listener until it is ready for an event.
+func (l *eventListener) waitReady(r *bufio.Reader, name string) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == listenerReady {
+			return nil
+		}
+		slog.Warn("unexpected listener output",
+			slog.String("process", name),
+			slog.String("line", line),
+		)
+	}
+}
+
+// readResult reads RESULT n then the n bytes of the result, OK or FAIL.
+func readResult(r *bufio.Reader) (bool, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	length, found := strings.CutPrefix(strings.TrimSpace(line), "RESULT ")
+	if !found {
+		return false, fmt.Errorf("%w: expected RESULT, got %q", errListenerProtocol, line)
+	}
+	n, err := strconv.Atoi(length)
+	if err != nil || n < 0 || n > listenerMaxResult {
+		return false, fmt.Errorf("%w: invalid RESULT length %q", errListenerProtocol, length)
+	}
+
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return false, err
+	}
+	switch string(body) {
+	case listenerResultOK:
+		return true, nil
+	case listenerResultFail:
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: unknown result %q", errListenerProtocol, body)
+}
+
+// listenerPools holds the listener of each eventlistener task, shared by the
+// processes of the task.
+type listenerPools struct {
+	mu        sync.Mutex
+	listeners map[string]*eventListener
+}
+
+// listener returns the listener of the eventlistener task pool, made if the
+// task has none yet or if its events changed.
+func (lp *listenerPools) listener(pool string, task *Task, subscribe func(EventFilter) (<-chan Event, func())) *eventListener {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+
+	if lp.listeners == nil {
+		lp.listeners = make(map[string]*eventListener)
+	}
+	l, exists := lp.listeners[pool]
+	if exists && slices.Equal(l.events, task.Events) && l.bufferSize == task.BufferSize {
+		return l
+	}
+	if exists {
+		l.close()
+	}
+	l = newEventListener(pool, task, subscribe)
+	lp.listeners[pool] = l
+	return l
+}
+
+// prune closes the listeners of the tasks which are gone, or aren't
+// eventlisteners anymore.
+func (lp *listenerPools) prune(tasks map[string]*Task) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+
+	for pool, l := range lp.listeners {
+		if task, exists := tasks[pool]; !exists || task.Type != TaskTypeEventListener {
+			l.close()
+			delete(lp.listeners, pool)
+		}
+	}
+}
+
+// prepareListener connects the standard input and output of the next child
+// to the listener of the process, which feeds it events until ctx is done.
+// It returns the write end of the output pipe, to close once the child is
+// started.
+func (p *Process) prepareListener(ctx context.Context, cmd *exec.Cmd) (*os.File, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// Not cmd.StdoutPipe, which must not be read from once cmd.Wait is
+	// called: the protocol is read from a pipe of the process.
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = w
+
+	// As set by supervisord, childutils rely on them.
+	cmd.Env = append(cmd.Environ(),
+		"SUPERVISOR_ENABLED=1",
+		"SUPERVISOR_PROCESS_NAME="+p.name,
+		"SUPERVISOR_GROUP_NAME="+p.taskName,
+	)
+	go func() {
+		<-ctx.Done()
+		stdout.Close()
+	}()
+	go p.listener.serve(ctx, p.name, stdin, stdout)
+	return w, nil
+}
@@ -0,0 +1,166 @@
+package taskmaster
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// listenerScript logs the events it receives to $1, refusing the first one.
+const listenerScript = `
+n=0
+while true; do
+	echo READY
+	read header || exit 0
+	len=${header##*len:}
+	payload=$(head -c "$len")
+	echo "$header $payload" >> "$1"
+	if [ $n = 0 ]; then printf "RESULT 4\nFAIL"; else printf "RESULT 2\nOK"; fi
+	n=1
+done
+`
+
+func TestService_EventListener(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "events")
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"listener": {
+				Type:         TaskTypeEventListener,
+				Cmd:          "sh",
+				Args:         []string{"-c", listenerScript, "sh", log},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    50 * time.Millisecond,
+				StopTime:     time.Second,
+				Events:       []string{"PROCESS_STATE_EXITED"},
+			},
+			"crasher": {
+				Cmd:          "sh",
+				Args:         []string{"-c", "sleep 0.1; exit 2"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    50 * time.Millisecond,
+				StopTime:     time.Second,
+				ExitCodes:    []int{0},
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if err := s.StartWait("listener"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartWait("crasher"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The refused event is sent again, with the same serial.
+	want := regexp.MustCompile(`^ver:3.0 server:taskmaster serial:(\d+) pool:listener poolserial:1 eventname:PROCESS_STATE_EXITED len:\d+ ` +
+		`processname:crasher groupname:crasher from_state:RUNNING expected:0 pid:[1-9]\d*\n`)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(log)
+		lines := regexp.MustCompile(`(?m)^.*\n`).FindAllString(string(data), -1)
+		if len(lines) >= 2 {
+			first, second := want.FindStringSubmatch(lines[0]), want.FindStringSubmatch(lines[1])
+			if first == nil || second == nil || first[1] != second[1] {
+				t.Fatalf("Expected the exited event of crasher twice, got:\n%s", data)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the exited event of crasher twice, got:\n%s", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestService_EventListenerPool(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "events")
+	script := `while echo READY && read header; do head -c "${header##*len:}" >/dev/null; echo "$SUPERVISOR_PROCESS_NAME" >> "$1"; printf "RESULT 2\nOK"; done`
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"listener": {
+				Type:         TaskTypeEventListener,
+				Cmd:          "sh",
+				Args:         []string{"-c", script, "sh", log},
+				NumProcs:     2,
+				StartRetries: 1,
+				StartTime:    50 * time.Millisecond,
+				StopTime:     time.Second,
+				Events:       []string{"PROCESS_STATE_EXITED"},
+			},
+			"crasher": {
+				Cmd:          "sh",
+				Args:         []string{"-c", "sleep 0.1; exit 2"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    50 * time.Millisecond,
+				StopTime:     time.Second,
+				ExitCodes:    []int{0},
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if err := s.Batch(s.StartWait, []string{"listener_00", "listener_01", "crasher"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The event is sent to a single process of the pool.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(log)
+		if len(data) > 0 {
+			time.Sleep(200 * time.Millisecond)
+			if data, _ = os.ReadFile(log); !regexp.MustCompile(`^listener_0[01]\n$`).Match(data) {
+				t.Fatalf("Expected the exited event of crasher once, got:\n%s", data)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the exited event of crasher")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestEventListener_Overflow(t *testing.T) {
+	l := newEventListener("pool", &Task{BufferSize: 2, Events: []string{"TICK_3600"}}, nil)
+	defer l.close()
+
+	for _, payload := range []string{"a", "b", "c"} {
+		l.push("TICK_3600", payload)
+	}
+	e := l.buffer[0]
+	if len(l.buffer) != 2 || e.payload != "b" || e.poolSerial != 2 {
+		t.Fatalf("Expected the oldest event to be dropped, got %+v", l.buffer)
+	}
+
+	l.ack(e.serial)
+	if len(l.buffer) != 1 || l.buffer[0].payload != "c" {
+		t.Fatalf("Expected the acknowledged event to be removed, got %+v", l.buffer)
+	}
+}
+
+func TestConfig_EventListener(t *testing.T) {
+	for _, tc := range []struct {
+		task Task
+		ok   bool
+	}{
+		{Task{Type: TaskTypeEventListener, Events: []string{"PROCESS_STATE", "TICK_60"}}, true},
+		{Task{Type: TaskTypeEventListener}, false},
+		{Task{Type: TaskTypeEventListener, Events: []string{"PROCESS_LOG"}}, false},
+		{Task{Type: TaskTypeEventListener, Events: []string{"EVENT"}, Stdout: "/tmp/out"}, false},
+		{Task{Events: []string{"EVENT"}}, false},
+	} {
+		err := tc.task.checkListener("listener")
+		if (err == nil) != tc.ok {
+			t.Errorf("%v: unexpected error: %v", tc.task.Events, err)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package taskmaster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/souhoc/taskmaster/util"
+)
+
+const (
+	LogOutputStdout = "stdout"
+	LogOutputStderr = "stderr"
+
+	// LogDirEnv overrides the default directory of the log files, for
+	// taskmasterctl which has no config.
+	LogDirEnv = "TASKMASTER_LOG_DIR"
+
+	defaultLogMaxBytes = 10 << 20
+	defaultLogBackups  = 5
+
+	// logBufferSize is how many bytes of its logs the service keeps.
+	logBufferSize = 256 * 1024
+)
+
+// LogConfig configures the logs of taskmaster itself. It is read at startup,
+// the level can then be changed with the loglevel command.
+type LogConfig struct {
+
+	// The format of the records: text, json or logfmt.
+	// Default: text.
+	Format string `yaml:"format"`
+
+	// The minimum level of the records: debug, info, warn or error.
+	// Default: info.
+	Level slog.Level `yaml:"level"`
+
+	// Whether to add the source file and line to the records.
+	// Default: false.
+	Source bool `yaml:"source"`
+
+	// Where to write the records: stdout, stderr or a file path.
+	// Default: the log file of the program.
+	Output string `yaml:"output"`
+
+	// The directory of the log files, named after each program:
+	// taskmaster.log, taskmasterd.log and taskmasterctl.log.
+	// Default: $TASKMASTER_LOG_DIR, or taskmaster in the user cache dir.
+	Dir string `yaml:"dir"`
+
+	// The size at which the log file is rotated, 0 to disable.
+	// Default: 10MB.
+	MaxBytes *ByteSize `yaml:"maxbytes"`
+
+	// How many rotated log files are kept.
+	// Default: 5.
+	Backups *int `yaml:"backups"`
+
+	// Whether to gzip the rotated log files.
+	// Default: false.
+	Compress bool `yaml:"compress"`
+
+	// How long rotated log files are kept, 0 to keep them.
+	// Default: 0.
+	MaxAge time.Duration `yaml:"maxage"`
+}
+
+func (c LogConfig) check() error {
+	if c.Format != "" && !slices.Contains(util.LogFormats, c.Format) {
+		return fmt.Errorf("config: log: unknown format: %s", c.Format)
+	}
+	if c.Backups != nil && *c.Backups < 0 {
+		return errors.New("config: log: negative backups")
+	}
+	return nil
+}
+
+// FilePath returns the path of the log file of program name.
+func (c LogConfig) FilePath(name string) (string, error) {
+	dir := c.Dir
+	if dir == "" {
+		dir = os.Getenv(LogDirEnv)
+	}
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find the log dir: %w", err)
+		}
+		dir = filepath.Join(cacheDir, "taskmaster")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create the log dir: %w", err)
+	}
+
+	return filepath.Join(dir, name+".log"), nil
+}
+
+// LogFile is the log file of a taskmaster program. It is appended to and
+// rotated once it reaches its max size.
+type LogFile struct {
+	*rotatingFile
+}
+
+// OpenLogFile opens the log file of program name.
+func (c LogConfig) OpenLogFile(name string) (*LogFile, error) {
+	path, err := c.FilePath(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.openLogFile(path)
+}
+
+// openLogFile opens a log file at path, rotated as set in the config.
+func (c LogConfig) openLogFile(path string) (*LogFile, error) {
+	maxBytes := ByteSize(defaultLogMaxBytes)
+	if c.MaxBytes != nil {
+		maxBytes = *c.MaxBytes
+	}
+	backups := defaultLogBackups
+	if c.Backups != nil {
+		backups = *c.Backups
+	}
+
+	f := &LogFile{newRotatingFile(path, maxBytes, backups, c.Compress, c.MaxAge)}
+	f.perm = 0600
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reopen closes the file, it is opened again at its path on the next write.
+// This lets an external tool rotate it.
+func (f *LogFile) Reopen() error {
+	return f.Close()
+}
+
+// FollowStdio makes the standard output and error, if they write to the
+// file, follow it when rotated or reopened. The daemon prints to its log file.
+func (f *LogFile) FollowStdio() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.openLocked(); err != nil {
+		return err
+	}
+	info, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	stdout, err := os.Stdout.Stat()
+	if err != nil || !os.SameFile(info, stdout) {
+		return nil
+	}
+
+	f.onOpen = func(file *os.File) {
+		// Nothing to report it to: the logs are written to this file.
+		_ = util.RedirectStdio(file)
+	}
+	return nil
+}
+
+// OpenOutput returns where to write the records, and the log file they are
+// written to if any, to reopen it. It is def if Output is empty, and a log
+// file rotated as set in the config if Output is a path.
+func (c LogConfig) OpenOutput(def *LogFile) (io.Writer, *LogFile, error) {
+	switch c.Output {
+	case "":
+		return def, def, nil
+	case LogOutputStdout:
+		return os.Stdout, nil, nil
+	case LogOutputStderr:
+		return os.Stderr, nil, nil
+	}
+
+	f, err := c.openLogFile(c.Output)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open log output: %w", err)
+	}
+	return f, f, nil
+}
+
+// LogLevel returns the minimum level of the logs.
+func (s *Service) LogLevel() slog.Level {
+	return s.logLevel.Level()
+}
+
+// SetLogLevel changes the minimum level of the logs.
+//
+// Parameters:
+//   - level: the new minimum level.
+func (s *Service) SetLogLevel(level slog.Level) {
+	s.logLevel.Set(level)
+	slog.Info("log level changed",
+		slog.String("level", level.String()),
+	)
+}
+
+// LogBuffer keeps the last records logged, for maintail.
+type LogBuffer struct {
+	*ringBuffer
+}
+
+func NewLogBuffer() *LogBuffer {
+	return &LogBuffer{newRingBuffer(logBufferSize)}
+}
+
+// MainTail returns the last lines logged by the service.
+//
+// Parameters:
+//   - lines: how many lines to return.
+//
+// Returns:
+//   - The lines, and the offset to follow the logs from.
+func (s *Service) MainTail(lines int) (string, int64, error) {
+	if s.logs == nil {
+		return "", 0, ErrNoLogBuffer
+	}
+
+	data, offset := s.logs.lines(lines)
+	return string(data), offset, nil
+}
+
+// MainFollow waits for the lines logged by the service after offset. It
+// returns with no lines after a while, or once ctx is done.
+//
+// Parameters:
+//   - offset: the offset returned by MainTail or the previous MainFollow.
+//
+// Returns:
+//   - The lines, and the offset to follow the logs from.
+func (s *Service) MainFollow(ctx context.Context, offset int64) (string, int64, error) {
+	if s.logs == nil {
+		return "", 0, ErrNoLogBuffer
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, followTimeout)
+	defer cancel()
+	s.logs.wait(ctx, offset)
+
+	data, offset := s.logs.since(offset)
+	return string(data), offset, nil
+}
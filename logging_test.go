@@ -0,0 +1,119 @@
+package taskmaster
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/souhoc/taskmaster/util"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLogFile(t *testing.T) {
+	dir := t.TempDir()
+	var cfg LogConfig
+	if err := yaml.Unmarshal([]byte("dir: "+dir+"\nmaxbytes: 16\nbackups: 1\n"), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "taskmasterd.log")
+	if err := os.WriteFile(path, []byte("previous\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := cfg.OpenLogFile("taskmasterd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write([]byte("first\n"))
+	if data, _ := os.ReadFile(path); string(data) != "previous\nfirst\n" {
+		t.Errorf("Expected the log to be appended to, got %q", data)
+	}
+
+	f.Write([]byte("second\n"))
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "previous\nfirst\n" {
+		t.Errorf("Expected the log to be rotated, got %q", data)
+	}
+
+	// Rotated by another tool, the file is created again once reopened.
+	os.Rename(path, path+".old")
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("third\n"))
+	if data, _ := os.ReadFile(path); string(data) != "third\n" {
+		t.Errorf("Expected a new log file, got %q", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a private log file, got %v", info.Mode())
+	}
+}
+
+func TestLogConfig_OpenOutput(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records.log")
+	maxBytes, backups := ByteSize(16), 1
+	cfg := LogConfig{Output: path, MaxBytes: &maxBytes, Backups: &backups}
+
+	out, f, err := cfg.OpenOutput(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if out != io.Writer(f) {
+		t.Fatalf("Expected the records to be written to the returned log file")
+	}
+	out.Write([]byte("first line\n"))
+	out.Write([]byte("second line\n"))
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "first line\n" {
+		t.Errorf("Expected the output to be rotated, got %q", data)
+	}
+
+	os.Rename(path, path+".old")
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	out.Write([]byte("third\n"))
+	if data, _ := os.ReadFile(path); string(data) != "third\n" {
+		t.Errorf("Expected the output to be reopened, got %q", data)
+	}
+}
+
+func TestService_MainTail(t *testing.T) {
+	logs := NewLogBuffer()
+	logger := slog.New(util.NewLogger("", io.Discard, util.WithFormat(util.LogFormatJSON), util.WithTee(logs)))
+	s := New(&Config{}, WithLogBuffer(logs))
+	defer s.Close()
+
+	logger.Info("first")
+	logger.Info("second", slog.String("process", "web"))
+
+	out, offset, err := s.MainTail(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out, "INFO: second process=web\n") || strings.Contains(out, "first") {
+		t.Errorf("Expected the last record in the text format, got %q", out)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		logger.Warn("third")
+	}()
+	out, _, err = s.MainFollow(context.Background(), offset)
+	if err != nil || !strings.Contains(out, "WARN: third") {
+		t.Errorf("Expected to follow the next record, got %q (%v)", out, err)
+	}
+
+	s2 := New(&Config{})
+	defer s2.Close()
+	if _, _, err := s2.MainTail(1); !errors.Is(err, ErrNoLogBuffer) {
+		t.Errorf("Expected ErrNoLogBuffer, got %v", err)
+	}
+}
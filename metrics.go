@@ -0,0 +1,343 @@
+package taskmaster
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net/http"
+	"net/rpc"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsPath is where the metrics are served.
+const MetricsPath = "/metrics"
+
+// rpcLatencyBuckets are the upper bounds, in seconds, of the RPC latency
+// histogram. Following a process waits up to followTimeout.
+var rpcLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 15}
+
+// metricsStates are the states of the taskmaster_process_state gauge.
+var metricsStates = []ProcessStatus{
+	ProcessStatusIdle,
+	ProcessStatusStarting,
+	ProcessStatusRunning,
+	ProcessStatusBackoff,
+	ProcessStatusStopping,
+	ProcessStatusStopped,
+	ProcessStatusExited,
+	ProcessStatusFatal,
+}
+
+// MetricsConfig configures the Prometheus metrics of taskmasterd. It is read
+// at startup.
+type MetricsConfig struct {
+
+	// The local address serving /metrics, as host:port.
+	// Default: none, the metrics are not served.
+	Address string `yaml:"address"`
+}
+
+// reloadStats counts the reloads of the service.
+type reloadStats struct {
+	mu       sync.Mutex
+	success  int
+	failure  int
+	last     time.Time
+	lastFail bool
+}
+
+func (r *reloadStats) record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.failure++
+	} else {
+		r.success++
+	}
+	r.last = time.Now()
+	r.lastFail = err != nil
+}
+
+// histogram counts observations in cumulative buckets.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(rpcLatencyBuckets))
+	}
+	for i, bound := range rpcLatencyBuckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Metrics measures a service and its RPC server, and serves the measures in
+// the Prometheus text format.
+type Metrics struct {
+	service *Service
+
+	mu  sync.Mutex
+	rpc map[string]*histogram
+}
+
+// NewMetrics returns the metrics of service.
+func NewMetrics(service *Service) *Metrics {
+	return &Metrics{
+		service: service,
+		rpc:     make(map[string]*histogram),
+	}
+}
+
+// ObserveRPC records the latency of a call to method.
+func (m *Metrics) ObserveRPC(method string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, exists := m.rpc[method]
+	if !exists {
+		h = new(histogram)
+		m.rpc[method] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// ServeConn serves the RPC requests of conn, as server.ServeConn, timing
+// each of them.
+func (m *Metrics) ServeConn(server *rpc.Server, conn io.ReadWriteCloser) {
+	buf := bufio.NewWriter(conn)
+	server.ServeCodec(&timedCodec{
+		ServerCodec: &gobServerCodec{
+			rwc:    conn,
+			dec:    gob.NewDecoder(conn),
+			enc:    gob.NewEncoder(buf),
+			encBuf: buf,
+		},
+		observe: m.ObserveRPC,
+		starts:  make(map[uint64]time.Time),
+	})
+}
+
+// ServeHTTP writes the metrics.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	mw := &metricsWriter{w: bufio.NewWriter(w)}
+	infos := m.service.InfoAll()
+
+	mw.family("taskmaster_process_state", "gauge", "The state of each process, 1 for its current state.")
+	for _, info := range infos {
+		for _, state := range metricsStates {
+			value := 0.0
+			if info.State == state {
+				value = 1
+			}
+			mw.sample("taskmaster_process_state", value, processLabels(info, "state", strings.ToLower(state.String()))...)
+		}
+	}
+
+	perProcess := []struct {
+		name, typ, help string
+		value           func(ProcessInfo) float64
+	}{
+		{"taskmaster_process_spawns_total", "counter", "The children spawned for each process.",
+			func(i ProcessInfo) float64 { return float64(i.StartCount) }},
+		{"taskmaster_process_restarts_total", "counter", "The automatic restarts of each process, after an exit or a failed check.",
+			func(i ProcessInfo) float64 { return float64(i.Restarts) }},
+		{"taskmaster_process_start_retries_total", "counter", "The failed starts of each process.",
+			func(i ProcessInfo) float64 { return float64(i.Retries) }},
+		{"taskmaster_process_last_exit_code", "gauge", "The exit code of the last child of each process, -1 if killed by a signal.",
+			func(i ProcessInfo) float64 { return float64(i.ExitCode) }},
+		{"taskmaster_process_uptime_seconds", "gauge", "How long the child of each process has been alive, 0 without a child.",
+			func(i ProcessInfo) float64 {
+				if i.Pid == 0 {
+					return 0
+				}
+				return time.Since(i.StartTime).Seconds()
+			}},
+	}
+	for _, metric := range perProcess {
+		mw.family(metric.name, metric.typ, metric.help)
+		for _, info := range infos {
+			mw.sample(metric.name, metric.value(info), processLabels(info)...)
+		}
+	}
+
+	r := &m.service.reloads
+	r.mu.Lock()
+	success, failure, last, lastFail := r.success, r.failure, r.last, r.lastFail
+	r.mu.Unlock()
+	mw.family("taskmaster_reloads_total", "counter", "The reloads of the configuration, by result.")
+	mw.sample("taskmaster_reloads_total", float64(success), "result", "success")
+	mw.sample("taskmaster_reloads_total", float64(failure), "result", "failure")
+	if !last.IsZero() {
+		lastSuccess := 1.0
+		if lastFail {
+			lastSuccess = 0
+		}
+		mw.family("taskmaster_last_reload_success", "gauge", "Whether the last reload succeeded.")
+		mw.sample("taskmaster_last_reload_success", lastSuccess)
+		mw.family("taskmaster_last_reload_timestamp_seconds", "gauge", "When the last reload happened.")
+		mw.sample("taskmaster_last_reload_timestamp_seconds", float64(last.Unix()))
+	}
+
+	m.mu.Lock()
+	methods := make([]string, 0, len(m.rpc))
+	for method := range m.rpc {
+		methods = append(methods, method)
+	}
+	slices.Sort(methods)
+	mw.family("taskmaster_rpc_request_duration_seconds", "histogram", "The latency of the RPC requests, by method.")
+	for _, method := range methods {
+		h := m.rpc[method]
+		for i, bound := range rpcLatencyBuckets {
+			mw.sample("taskmaster_rpc_request_duration_seconds_bucket", float64(h.counts[i]),
+				"method", method, "le", strconv.FormatFloat(bound, 'g', -1, 64))
+		}
+		mw.sample("taskmaster_rpc_request_duration_seconds_bucket", float64(h.count), "method", method, "le", "+Inf")
+		mw.sample("taskmaster_rpc_request_duration_seconds_sum", h.sum, "method", method)
+		mw.sample("taskmaster_rpc_request_duration_seconds_count", float64(h.count), "method", method)
+	}
+	m.mu.Unlock()
+
+	return mw.n, mw.flush()
+}
+
+func processLabels(info ProcessInfo, labels ...string) []string {
+	return append([]string{"process", info.Name, "task", info.Task}, labels...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsWriter writes the Prometheus text format, keeping the first error.
+type metricsWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (mw *metricsWriter) printf(format string, args ...any) {
+	if mw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(mw.w, format, args...)
+	mw.n += int64(n)
+	mw.err = err
+}
+
+func (mw *metricsWriter) family(name, typ, help string) {
+	mw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a value, labels being pairs of names and values.
+func (mw *metricsWriter) sample(name string, value float64, labels ...string) {
+	var ls strings.Builder
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			ls.WriteByte(',')
+		}
+		fmt.Fprintf(&ls, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+	if ls.Len() > 0 {
+		mw.printf("%s{%s} %s\n", name, ls.String(), strconv.FormatFloat(value, 'f', -1, 64))
+		return
+	}
+	mw.printf("%s %s\n", name, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func (mw *metricsWriter) flush() error {
+	if mw.err != nil {
+		return mw.err
+	}
+	return mw.w.Flush()
+}
+
+// timedCodec measures the time between reading a request and replying to
+// it.
+type timedCodec struct {
+	rpc.ServerCodec
+	observe func(method string, d time.Duration)
+
+	mu     sync.Mutex
+	starts map[uint64]time.Time
+}
+
+func (c *timedCodec) ReadRequestHeader(r *rpc.Request) error {
+	err := c.ServerCodec.ReadRequestHeader(r)
+	if err == nil {
+		c.mu.Lock()
+		c.starts[r.Seq] = time.Now()
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func (c *timedCodec) WriteResponse(r *rpc.Response, body any) error {
+	c.mu.Lock()
+	start, exists := c.starts[r.Seq]
+	delete(c.starts, r.Seq)
+	c.mu.Unlock()
+
+	if exists {
+		c.observe(r.ServiceMethod, time.Since(start))
+	}
+	return c.ServerCodec.WriteResponse(r, body)
+}
+
+// gobServerCodec is the codec of rpc.ServeConn, which net/rpc doesn't
+// export.
+type gobServerCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	closed bool
+}
+
+func (c *gobServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	return c.dec.Decode(r)
+}
+
+func (c *gobServerCodec) ReadRequestBody(body any) error {
+	return c.dec.Decode(body)
+}
+
+func (c *gobServerCodec) WriteResponse(r *rpc.Response, body any) error {
+	if err := c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			c.Close()
+		}
+		return err
+	}
+	if err := c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			c.Close()
+		}
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *gobServerCodec) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
@@ -0,0 +1,61 @@
+package taskmaster
+
+import (
+	"net"
+	"net/http/httptest"
+	"net/rpc"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"web": {
+				Cmd:          "sleep",
+				Args:         []string{"10"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    50 * time.Millisecond,
+				StopTime:     time.Second,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+	metrics := NewMetrics(s)
+
+	server := rpc.NewServer()
+	if err := server.Register(NewRPCService(s)); err != nil {
+		t.Fatal(err)
+	}
+	serverConn, conn := net.Pipe()
+	go metrics.ServeConn(server, serverConn)
+	client := rpc.NewClient(conn)
+	defer client.Close()
+	if err := client.Call(RPCServiceStart, "web", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", MetricsPath, nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`taskmaster_process_state{process="web",task="web",state="running"} 1`,
+		`taskmaster_process_state{process="web",task="web",state="fatal"} 0`,
+		`taskmaster_process_spawns_total{process="web",task="web"} 1`,
+		`taskmaster_process_restarts_total{process="web",task="web"} 0`,
+		`taskmaster_reloads_total{result="failure"} 0`,
+		`taskmaster_rpc_request_duration_seconds_count{method="RPCService.Start"} 1`,
+		`# TYPE taskmaster_rpc_request_duration_seconds histogram`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in:\n%s", want, body)
+		}
+	}
+	if !regexp.MustCompile(`(?m)^taskmaster_process_uptime_seconds\{process="web",task="web"\} 0\.\d+`).MatchString(body) {
+		t.Errorf("Expected the uptime of web in:\n%s", body)
+	}
+}
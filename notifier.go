@@ -0,0 +1,281 @@
+package taskmaster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	NotifierTypeWebhook = "webhook"
+	NotifierTypeSlack   = "slack"
+	NotifierTypeDiscord = "discord"
+	NotifierTypeEmail   = "email"
+	NotifierTypeExec    = "exec"
+
+	defaultNotifierTemplate = "{{.Level}} {{.Type}}{{with .Process}} {{.}}{{end}}: {{.Message}}"
+	defaultSMTPAddress      = "localhost:25"
+
+	// How long a single notification may take.
+	notifierTimeout = 10 * time.Second
+	// How long closing the service waits for the pending notifications.
+	notifierDrainTimeout = 10 * time.Second
+)
+
+var defaultNotifierEvents = []EventType{EventProcessExited, EventProcessFatal, EventProcessLimit, EventConfigReloaded}
+
+// NotifierConfig configures where and when events are notified. The
+// notifiers are made again when they change on reload.
+type NotifierConfig struct {
+
+	// The backend: webhook (a JSON post of the event), slack, discord,
+	// email or exec.
+	Type string `yaml:"type"`
+
+	// The url to post to, for webhook, slack and discord.
+	URL string `yaml:"url"`
+
+	// The SMTP relay, for email.
+	// Default: localhost:25.
+	Address string `yaml:"address"`
+
+	// The sender of the emails.
+	// Default: taskmaster@hostname.
+	From string `yaml:"from"`
+
+	// The recipients of the emails.
+	To []string `yaml:"to"`
+
+	// The command to run, for exec. The message is written to its standard
+	// input and the event is in TASKMASTER_* environment variables.
+	Cmd  string   `yaml:"cmd"`
+	Args []string `yaml:"args"`
+
+	// Which events are notified.
+	// Default: the exited, fatal, limit and reload events of all the tasks,
+	// from the info level.
+	Filter EventFilter `yaml:"filter"`
+
+	// A text/template executed with the Event to make the message.
+	// Default: {{.Level}} {{.Type}}{{with .Process}} {{.}}{{end}}: {{.Message}}.
+	Template string `yaml:"template"`
+}
+
+// makeNotifiers makes the notifiers of cfgs, subscribed to the events of the
+// service.
+func (s *Service) makeNotifiers(cfgs []NotifierConfig) []io.Closer {
+	notifiers := make([]io.Closer, 0, len(cfgs))
+	for _, nc := range cfgs {
+		events, unsubscribe := s.events.subscribe(nc.filter())
+		notifiers = append(notifiers, newNotifier(nc, events, unsubscribe))
+	}
+	return notifiers
+}
+
+// filter returns the filter of the notifier, with its default events.
+func (c NotifierConfig) filter() EventFilter {
+	filter := c.Filter
+	if len(filter.Events) == 0 {
+		filter.Events = defaultNotifierEvents
+	}
+	return filter
+}
+
+// check verifies the i-th notifier.
+func (c NotifierConfig) check(i int) error {
+	switch c.Type {
+	case NotifierTypeWebhook, NotifierTypeSlack, NotifierTypeDiscord:
+		if c.URL == "" {
+			return fmt.Errorf("config: notifier %d: missing url", i)
+		}
+	case NotifierTypeEmail:
+		if len(c.To) == 0 {
+			return fmt.Errorf("config: notifier %d: missing recipients", i)
+		}
+	case NotifierTypeExec:
+		if c.Cmd == "" {
+			return fmt.Errorf("config: notifier %d: missing cmd", i)
+		}
+	default:
+		return fmt.Errorf("config: notifier %d: unknown type: %s", i, c.Type)
+	}
+
+	if err := c.Filter.check(); err != nil {
+		return fmt.Errorf("config: notifier %d: %w", i, err)
+	}
+	if _, err := c.template(); err != nil {
+		return fmt.Errorf("config: notifier %d: %w", i, err)
+	}
+	return nil
+}
+
+func (c NotifierConfig) template() (*template.Template, error) {
+	text := c.Template
+	if text == "" {
+		text = defaultNotifierTemplate
+	}
+	return template.New(c.Type).Parse(text)
+}
+
+// notifier delivers the events it subscribed to in the background.
+type notifier struct {
+	cfg         NotifierConfig
+	tmpl        *template.Template
+	events      <-chan Event
+	unsubscribe func()
+	done        chan struct{}
+}
+
+func newNotifier(cfg NotifierConfig, events <-chan Event, unsubscribe func()) *notifier {
+	tmpl, err := cfg.template()
+	if err != nil {
+		slog.Error("invalid notifier template, using the default one",
+			slog.String("notifier", cfg.Type),
+			slog.Any("error", err),
+		)
+		tmpl = template.Must(template.New(cfg.Type).Parse(defaultNotifierTemplate))
+	}
+
+	n := &notifier{
+		cfg:         cfg,
+		tmpl:        tmpl,
+		events:      events,
+		unsubscribe: unsubscribe,
+		done:        make(chan struct{}),
+	}
+	go n.run()
+
+	return n
+}
+
+// Close ends the subscription and waits for the received events to be
+// delivered.
+func (n *notifier) Close() error {
+	n.unsubscribe()
+	select {
+	case <-n.done:
+		return nil
+	case <-time.After(notifierDrainTimeout):
+		return fmt.Errorf("notifier %s: undelivered events", n.cfg.Type)
+	}
+}
+
+func (n *notifier) run() {
+	defer close(n.done)
+
+	for e := range n.events {
+		if err := n.deliver(e); err != nil {
+			slog.Warn("notification failed",
+				slog.String("notifier", n.cfg.Type),
+				slog.String("event", string(e.Type)),
+				slog.Any("error", err),
+			)
+		}
+	}
+}
+
+func (n *notifier) deliver(e Event) error {
+	var msg strings.Builder
+	if err := n.tmpl.Execute(&msg, e); err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifierTimeout)
+	defer cancel()
+
+	switch n.cfg.Type {
+	case NotifierTypeWebhook:
+		return postJSON(ctx, n.cfg.URL, struct {
+			Event
+			Text string `json:"text"`
+		}{e, msg.String()})
+	case NotifierTypeSlack:
+		return postJSON(ctx, n.cfg.URL, map[string]string{
+			"text": msg.String(),
+		})
+	case NotifierTypeDiscord:
+		return postJSON(ctx, n.cfg.URL, map[string]string{
+			"username": "Taskmaster",
+			"content":  msg.String(),
+		})
+	case NotifierTypeEmail:
+		return n.mail(e, msg.String())
+	default:
+		return n.exec(ctx, e, msg.String())
+	}
+}
+
+func postJSON(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// mail sends msg through the SMTP relay, without authentication.
+func (n *notifier) mail(e Event, msg string) error {
+	address := n.cfg.Address
+	if address == "" {
+		address = defaultSMTPAddress
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	from := n.cfg.From
+	if from == "" {
+		from = "taskmaster@" + hostname
+	}
+
+	subject := fmt.Sprintf("[taskmaster] %s %s", e.Type, e.Process)
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", from)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(n.cfg.To, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", strings.TrimSpace(subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", e.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&body, "\r\n%s\r\n", msg)
+
+	return smtp.SendMail(address, nil, from, n.cfg.To, []byte(body.String()))
+}
+
+// exec runs the command of the notifier with msg on its standard input.
+func (n *notifier) exec(ctx context.Context, e Event, msg string) error {
+	cmd := exec.CommandContext(ctx, n.cfg.Cmd, n.cfg.Args...)
+	cmd.Stdin = strings.NewReader(msg)
+	cmd.Env = append(os.Environ(),
+		"TASKMASTER_EVENT="+string(e.Type),
+		"TASKMASTER_LEVEL="+e.Level.String(),
+		"TASKMASTER_PROCESS="+e.Process,
+		"TASKMASTER_TASK="+e.Task,
+		fmt.Sprintf("TASKMASTER_EXIT_CODE=%d", e.ExitCode),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package taskmaster
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestNotifierFilter(t *testing.T) {
+	var cfg NotifierConfig
+	err := yaml.Unmarshal([]byte(`
+type: exec
+cmd: "true"
+filter:
+  events: [exited, fatal]
+  level: warn
+  tasks: ["web*"]
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.check(0); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		event Event
+		want  bool
+	}{
+		{Event{Type: EventProcessFatal, Level: slog.LevelError, Task: "webapp"}, true},
+		{Event{Type: EventProcessExited, Level: slog.LevelWarn, Task: "web"}, true},
+		{Event{Type: EventProcessExited, Level: slog.LevelWarn, Task: "worker"}, false},
+		{Event{Type: EventProcessExited, Level: slog.LevelInfo, Task: "web"}, false},
+		{Event{Type: EventConfigReloaded, Level: slog.LevelError}, false},
+	}
+	for _, tt := range tests {
+		if got := cfg.Filter.match(tt.event); got != tt.want {
+			t.Errorf("match(%+v): got %v, want %v", tt.event, got, tt.want)
+		}
+	}
+}
+
+func TestNotifierConfig_Check(t *testing.T) {
+	tests := []struct {
+		cfg NotifierConfig
+		err string
+	}{
+		{NotifierConfig{Type: "pager"}, "unknown type"},
+		{NotifierConfig{Type: NotifierTypeSlack}, "missing url"},
+		{NotifierConfig{Type: NotifierTypeEmail}, "missing recipients"},
+		{NotifierConfig{Type: NotifierTypeExec, Cmd: "true", Filter: EventFilter{Events: []EventType{"started"}}}, "unknown event"},
+		{NotifierConfig{Type: NotifierTypeExec, Cmd: "true", Template: "{{.Process"}, "unclosed action"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.check(0)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("check(%+v): got %v, want %q", tt.cfg, err, tt.err)
+		}
+	}
+}
+
+func TestService_NotifiesFatal(t *testing.T) {
+	bodies := make(chan map[string]any, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	out := filepath.Join(t.TempDir(), "notified")
+	cfg := &Config{
+		Notifiers: []NotifierConfig{
+			{
+				Type:   NotifierTypeWebhook,
+				URL:    server.URL,
+				Filter: EventFilter{Events: []EventType{EventProcessFatal}},
+			},
+			{
+				Type:     NotifierTypeExec,
+				Cmd:      "sh",
+				Args:     []string{"-c", `cat > "$0"; echo " $TASKMASTER_EVENT" >> "$0"`, out},
+				Template: "{{.Process}} {{.Message}}",
+			},
+		},
+		Tasks: map[string]*Task{
+			"broken": {
+				Cmd:          "false",
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    time.Second,
+				StopTime:     time.Second,
+			},
+		},
+	}
+	s := New(cfg)
+
+	s.Start("broken")
+	select {
+	case body := <-bodies:
+		if body["type"] != "fatal" || body["process"] != "broken" || !strings.Contains(body["text"].(string), "gave up") {
+			t.Errorf("Expected a fatal event, got %v", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the webhook to be notified")
+	}
+
+	s.Close()
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Expected the exec notifier to run: %v", err)
+	}
+	if got := string(data); got != "broken gave up after 1 tries fatal\n" {
+		t.Errorf("Expected the templated message, got %q", got)
+	}
+}
+
+func TestService_ReloadNotifiers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	out := filepath.Join(dir, "notified")
+	defer func(previous []string) { paths = previous }(paths)
+	paths = []string{path}
+
+	config := `
+tasks:
+  web:
+    cmd: sleep
+    args: ["10"]
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var cfg Config
+	if err := cfg.Load(); err != nil {
+		t.Fatal(err)
+	}
+	s := New(&cfg)
+	defer s.Close()
+
+	notifiers := `
+notifiers:
+  - type: exec
+    cmd: sh
+    args: ["-c", 'cat > "$0"', "` + out + `"]
+    template: "{{.Type}}"
+`
+	if err := os.WriteFile(path, []byte(config+notifiers), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := s.Reload(); !changed || err != nil {
+		t.Fatalf("Expected the notifiers to change, got %v", err)
+	}
+
+	// The new notifier gets the reload event.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if data, _ := os.ReadFile(out); string(data) == "reload" {
+			break
+		}
+		if time.Now().After(deadline) {
+			data, _ := os.ReadFile(out)
+			t.Fatalf("Expected the reload to be notified, got %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
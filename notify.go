@@ -0,0 +1,117 @@
+package taskmaster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// notifyBufferSize is the maximum size of a notify message.
+const notifyBufferSize = 4096
+
+// notifySockets numbers the notify sockets, so that the socket of an exited
+// child, removed asynchronously, is never the one of the next child.
+var notifySockets atomic.Uint64
+
+// prepareNotify opens the notify socket of the next child and sets
+// NOTIFY_SOCKET in its environment. Messages are forwarded to the supervisor
+// until ctx is done.
+func (p *Process) prepareNotify(ctx context.Context, cmd *exec.Cmd) error {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("taskmaster-%d-%s-%d.notify", os.Getpid(), p.name, notifySockets.Add(1)))
+	os.Remove(path)
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to open notify socket: %w", err)
+	}
+
+	notifyC := make(chan string)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+		os.Remove(path)
+	}()
+	go func() {
+		buf := make([]byte, notifyBufferSize)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("notify socket",
+						slog.String("process", p.name),
+						slog.Any("error", err),
+					)
+				}
+				return
+			}
+			select {
+			case notifyC <- string(buf[:n]):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	cmd.Env = append(cmd.Environ(), "NOTIFY_SOCKET="+path)
+	if p.task.Watchdog > 0 {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("WATCHDOG_USEC=%d", p.task.Watchdog.Microseconds()))
+	}
+	p.notifyC = notifyC
+	p.ready = false
+	return nil
+}
+
+// handleNotify applies a message sent by the child on its notify socket.
+func (p *Process) handleNotify(msg string) {
+	for _, line := range strings.Split(msg, "\n") {
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+
+		switch key {
+		case "READY":
+			if value != "1" || p.ready {
+				continue
+			}
+			p.ready = true
+			if p.Status() == ProcessStatusStarting {
+				p.timer = nil
+				p.running()
+			}
+			p.armWatchdog()
+		case "STATUS":
+			p.mu.Lock()
+			p.statusText = value
+			p.mu.Unlock()
+		case "WATCHDOG":
+			switch value {
+			case "1":
+				p.armWatchdog()
+			case "trigger":
+				p.watchdog = nil
+				p.restart("watchdog triggered")
+			}
+		case "STOPPING":
+			slog.Info("child stopping",
+				slog.String("process", p.name),
+			)
+		}
+	}
+}
+
+// armWatchdog resets the watchdog deadline of the child.
+func (p *Process) armWatchdog() {
+	if p.task.Watchdog <= time.Duration(0) || !p.ready {
+		return
+	}
+	p.watchdog = time.After(p.task.Watchdog)
+}
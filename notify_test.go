@@ -0,0 +1,88 @@
+package taskmaster
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestNotifyHelperProcess isn't a real test, it is the child used by the
+// notify tests.
+func TestNotifyHelperProcess(t *testing.T) {
+	if os.Getenv("TASKMASTER_NOTIFY_HELPER") != "1" {
+		return
+	}
+
+	conn, err := net.Dial("unixgram", os.Getenv("NOTIFY_SOCKET"))
+	if err != nil {
+		os.Exit(2)
+	}
+	conn.Write([]byte("STATUS=warming up"))
+	time.Sleep(50 * time.Millisecond)
+	conn.Write([]byte("READY=1\nSTATUS=serving"))
+	time.Sleep(10 * time.Second)
+	os.Exit(0)
+}
+
+func notifyHelperTask(watchdog time.Duration) *Task {
+	return &Task{
+		Cmd:          os.Args[0],
+		Args:         []string{"-test.run=^TestNotifyHelperProcess$"},
+		NumProcs:     1,
+		StartRetries: 1,
+		StartTime:    time.Second * 5,
+		StopTime:     time.Second,
+		Env:          map[string]string{"TASKMASTER_NOTIFY_HELPER": "1"},
+		Notify:       true,
+		Watchdog:     watchdog,
+	}
+}
+
+func TestService_NotifyReady(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"notifier": notifyHelperTask(0),
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	st := time.Now()
+	if err := s.StartWait("notifier"); err != nil {
+		t.Fatalf("Expected StartWait to succeed, got %v", err)
+	}
+	if time.Since(st) >= cfg.Tasks["notifier"].StartTime {
+		t.Error("Expected process to be running on READY=1, before StartTime")
+	}
+
+	info, _ := s.Info("notifier")
+	if info.StatusText != "serving" {
+		t.Errorf("Expected status text serving, got %q", info.StatusText)
+	}
+}
+
+func TestService_NotifyWatchdog(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"notifier": notifyHelperTask(time.Millisecond * 100),
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if err := s.StartWait("notifier"); err != nil {
+		t.Fatalf("Expected StartWait to succeed, got %v", err)
+	}
+
+	process := s.processes["notifier"]
+	ctx, cancel := context.WithTimeout(s.Ctx, 5*time.Second)
+	defer cancel()
+	process.waitFor(ctx, func(ProcessStatus, HealthStatus) bool {
+		return process.Info().StartCount >= 2
+	})
+	if info := process.Info(); info.StartCount < 2 {
+		t.Errorf("Expected process to be restarted by the watchdog, got %d spawns", info.StartCount)
+	}
+}
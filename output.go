@@ -0,0 +1,291 @@
+package taskmaster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+
+	// outputBufferSize is how many bytes of each output are kept per process.
+	outputBufferSize = 64 * 1024
+
+	// followTimeout is how long Follow waits for new output before returning.
+	followTimeout = 10 * time.Second
+)
+
+// ringBuffer keeps the last size bytes written to it. Offsets count every
+// byte ever written, so that a reader can ask for what it didn't read yet.
+type ringBuffer struct {
+	mu      sync.Mutex
+	buf     []byte
+	written int64
+	changed chan struct{}
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{
+		buf:     make([]byte, size),
+		changed: make(chan struct{}),
+	}
+}
+
+func (b *ringBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	size := len(b.buf)
+	if len(p) > size {
+		b.written += int64(len(p) - size)
+		p = p[len(p)-size:]
+	}
+	pos := int(b.written % int64(size))
+	copied := copy(b.buf[pos:], p)
+	copy(b.buf, p[copied:])
+	b.written += int64(len(p))
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+	return n, nil
+}
+
+// since returns the bytes written after offset which are still kept, and
+// the offset to read from next.
+func (b *ringBuffer) since(offset int64) ([]byte, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	size := int64(len(b.buf))
+	offset = max(offset, b.written-size, 0)
+	if offset >= b.written {
+		return nil, b.written
+	}
+
+	out := make([]byte, 0, b.written-offset)
+	start := int(offset % size)
+	end := int(b.written % size)
+	if start < end {
+		return append(out, b.buf[start:end]...), b.written
+	}
+	out = append(out, b.buf[start:]...)
+	return append(out, b.buf[:end]...), b.written
+}
+
+// lines returns the last n lines kept, and the offset to follow them from.
+func (b *ringBuffer) lines(n int) ([]byte, int64) {
+	data, offset := b.since(0)
+	if n <= 0 {
+		return nil, offset
+	}
+
+	i := len(bytes.TrimSuffix(data, []byte("\n")))
+	for ; n > 0 && i >= 0; n-- {
+		i = bytes.LastIndexByte(data[:i], '\n')
+	}
+	return data[i+1:], offset
+}
+
+// wait blocks until bytes are written after offset, or ctx is done.
+func (b *ringBuffer) wait(ctx context.Context, offset int64) {
+	b.mu.Lock()
+	written, changed := b.written, b.changed
+	b.mu.Unlock()
+
+	if written > offset {
+		return
+	}
+	select {
+	case <-changed:
+	case <-ctx.Done():
+	}
+}
+
+func (b *ringBuffer) String() string {
+	data, _ := b.since(0)
+	return string(data)
+}
+
+// teeOutput copies the output of a child to its file, if any, and to
+// buffers. Closing it closes the file.
+type teeOutput struct {
+	w    io.Writer
+	tees []io.Writer
+}
+
+func (t teeOutput) Write(p []byte) (int, error) {
+	n, err := len(p), error(nil)
+	if t.w != nil {
+		n, err = t.w.Write(p)
+	}
+	for _, tee := range t.tees {
+		tee.Write(p)
+	}
+	return n, err
+}
+
+func (t teeOutput) Close() error {
+	if c, ok := t.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// lineWriter decorates each line written to w with a prefix. An unfinished
+// line is held until its end, or until the writer is closed.
+type lineWriter struct {
+	w      io.Writer
+	prefix func() string
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data := append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if err := l.writeLine(data[:i+1]); err != nil {
+			l.partial = nil
+			return 0, err
+		}
+		data = data[i+1:]
+	}
+	l.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+func (l *lineWriter) writeLine(line []byte) error {
+	out := make([]byte, 0, len(line)+64)
+	out = append(out, l.prefix()...)
+	out = append(out, line...)
+	_, err := l.w.Write(out)
+	return err
+}
+
+// Close writes the unfinished line and closes w.
+func (l *lineWriter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var err error
+	if len(l.partial) > 0 {
+		err = l.writeLine(append(l.partial, '\n'))
+		l.partial = nil
+	}
+	if c, ok := l.w.(io.Closer); ok {
+		err = errors.Join(err, c.Close())
+	}
+	return err
+}
+
+// linePrefix returns the decoration of the lines of a stream of the process,
+// following its task LogTimestamp and LogPrefix.
+func (p *Process) linePrefix(stream string) func() string {
+	return func() string {
+		var prefix string
+		if p.task.LogTimestamp {
+			prefix = time.Now().Format(time.RFC3339) + " "
+		}
+		if p.task.LogPrefix {
+			prefix += fmt.Sprintf("[%s %s] ", p.name, stream)
+		}
+		return prefix
+	}
+}
+
+// output returns the buffer of an output stream of the process.
+func (p *Process) output(stream string) (*ringBuffer, error) {
+	switch stream {
+	case "", OutputStdout:
+		return p.stdout, nil
+	case OutputStderr:
+		return p.stderr, nil
+	default:
+		return nil, fmt.Errorf("unknown output stream: %s", stream)
+	}
+}
+
+// TailArgs are the arguments of the Tail RPC.
+type TailArgs struct {
+	Name   string
+	Stream string
+	Lines  int
+
+	// Follow waits for the output written after Offset instead of returning
+	// the last Lines.
+	Follow bool
+	Offset int64
+}
+
+// TailReply is the reply of the Tail RPC.
+type TailReply struct {
+	Output string
+
+	// The offset to follow the output from.
+	Offset int64
+}
+
+// Tail returns the last lines of an output stream of a process.
+//
+// Parameters:
+//   - name: the name of the process.
+//   - stream: stdout or stderr.
+//   - lines: how many lines to return.
+//
+// Returns:
+//   - The lines, and the offset to Follow the stream from.
+func (s *Service) Tail(name, stream string, lines int) (string, int64, error) {
+	process, err := s.process(name)
+	if err != nil {
+		return "", 0, err
+	}
+	buf, err := process.output(stream)
+	if err != nil {
+		return "", 0, err
+	}
+
+	data, offset := buf.lines(lines)
+	return string(data), offset, nil
+}
+
+// Follow waits for the output written to a stream of a process after
+// offset. It returns with no output after a while, or once ctx is done.
+//
+// Parameters:
+//   - name: the name of the process.
+//   - stream: stdout or stderr.
+//   - offset: the offset returned by Tail or the previous Follow.
+//
+// Returns:
+//   - The output, and the offset to follow the stream from.
+func (s *Service) Follow(ctx context.Context, name, stream string, offset int64) (string, int64, error) {
+	process, err := s.process(name)
+	if err != nil {
+		return "", 0, err
+	}
+	buf, err := process.output(stream)
+	if err != nil {
+		return "", 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, followTimeout)
+	defer cancel()
+	buf.wait(ctx, offset)
+
+	data, offset := buf.since(offset)
+	return string(data), offset, nil
+}
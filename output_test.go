@@ -0,0 +1,138 @@
+package taskmaster
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRingBuffer(t *testing.T) {
+	b := newRingBuffer(8)
+	b.Write([]byte("hello "))
+	b.Write([]byte("world"))
+
+	if got := b.String(); got != "lo world" {
+		t.Errorf("Expected the last 8 bytes, got %q", got)
+	}
+
+	data, offset := b.since(7)
+	if string(data) != "orld" || offset != 11 {
+		t.Errorf("Expected %q at 11, got %q at %d", "orld", data, offset)
+	}
+
+	b.Write([]byte("0123456789abc"))
+	if data, offset := b.since(0); string(data) != "56789abc" || offset != 24 {
+		t.Errorf("Expected the last 8 bytes of a big write at 24, got %q at %d", data, offset)
+	}
+}
+
+func TestRingBufferLines(t *testing.T) {
+	b := newRingBuffer(64)
+	b.Write([]byte("one\ntwo\nthree\n"))
+
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, ""},
+		{1, "three\n"},
+		{2, "two\nthree\n"},
+		{10, "one\ntwo\nthree\n"},
+	}
+	for _, tt := range tests {
+		if got, _ := b.lines(tt.n); string(got) != tt.want {
+			t.Errorf("lines(%d): expected %q, got %q", tt.n, tt.want, got)
+		}
+	}
+}
+
+func TestService_TailAndFollow(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"talker": {
+				Cmd:          "sh",
+				Args:         []string{"-c", "echo first; echo err >&2; sleep 1; echo second; sleep 10"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    time.Millisecond * 100,
+				StopTime:     time.Second,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if err := s.StartWait("talker"); err != nil {
+		t.Fatalf("Expected StartWait to succeed, got %v", err)
+	}
+
+	out, offset, err := s.Tail("talker", OutputStdout, 10)
+	if err != nil || out != "first\n" {
+		t.Fatalf("Expected %q, got %q (%v)", "first\n", out, err)
+	}
+	if out, _, _ := s.Tail("talker", OutputStderr, 10); out != "err\n" {
+		t.Errorf("Expected %q on stderr, got %q", "err\n", out)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, _, err = s.Follow(ctx, "talker", OutputStdout, offset)
+	if err != nil || !strings.Contains(out, "second") {
+		t.Errorf("Expected to follow %q, got %q (%v)", "second\n", out, err)
+	}
+
+	if _, _, err := s.Tail("talker", "stdin", 10); err == nil {
+		t.Error("Expected an unknown stream to fail")
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var out strings.Builder
+	l := &lineWriter{w: &out, prefix: func() string { return "> " }}
+
+	l.Write([]byte("one\ntw"))
+	l.Write([]byte("o\nthree"))
+	if got := out.String(); got != "> one\n> two\n" {
+		t.Errorf("Expected complete lines only, got %q", got)
+	}
+
+	l.Close()
+	if got := out.String(); got != "> one\n> two\n> three\n" {
+		t.Errorf("Expected the unfinished line on close, got %q", got)
+	}
+}
+
+func TestService_RedirectStderr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"job": {
+				Type:           TaskTypeOneshot,
+				Cmd:            "sh",
+				Args:           []string{"-c", "echo one; echo two >&2; echo three"},
+				NumProcs:       2,
+				StartRetries:   1,
+				StartTime:      time.Second,
+				StopTime:       time.Second,
+				Stdout:         path,
+				RedirectStderr: true,
+				LogPrefix:      true,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if _, err := s.Run("job_01"); err != nil {
+		t.Fatalf("Expected Run to succeed, got %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	want := "[job_01 stdout] one\n[job_01 stdout] two\n[job_01 stdout] three\n"
+	if string(data) != want {
+		t.Errorf("Expected %q, got %q", want, data)
+	}
+}
@@ -0,0 +1,33 @@
+package taskmaster
+
+import (
+	"cmp"
+	"slices"
+)
+
+// tiers groups the processes by the priority of their task, in ascending
+// order. Unknown processes are put in the first tier.
+func (s *Service) tiers(names []string) [][]string {
+	s.mu.Lock()
+	priority := func(name string) int {
+		process, exists := s.processes[name]
+		if !exists || process == nil {
+			return 0
+		}
+		return process.task.Priority
+	}
+	sorted := slices.Clone(names)
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		return cmp.Compare(priority(a), priority(b))
+	})
+	var tiers [][]string
+	for i, name := range sorted {
+		if i == 0 || priority(name) != priority(sorted[i-1]) {
+			tiers = append(tiers, nil)
+		}
+		tiers[len(tiers)-1] = append(tiers[len(tiers)-1], name)
+	}
+	s.mu.Unlock()
+
+	return tiers
+}
@@ -1,7 +1,15 @@
 package taskmaster
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
 	"os/exec"
+	"slices"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -9,46 +17,801 @@ import (
 //go:generate stringer --type ProcessStatus --trimprefix ProcessStatus
 type ProcessStatus int
 
+// The states of a process follow the supervisord semantics.
 const (
+	// The process doesn't exist.
 	ProcessStatusUnknown ProcessStatus = iota
+	// The process has never been started.
+	ProcessStatusIdle
+	// The process is starting, it has not been running for StartTime yet.
+	ProcessStatusStarting
+	// The process has been running for at least StartTime.
 	ProcessStatusRunning
-	ProcessStatusExited
+	// The process failed to start, or exited, and waits before its next start.
+	ProcessStatusBackoff
+	// The process is stopping after a stop request.
+	ProcessStatusStopping
+	// The process has been deliberately stopped.
 	ProcessStatusStopped
-	ProcessStatusIdle
-	ProcessStatusFailed
+	// The process exited on its own after it was running.
+	ProcessStatusExited
+	// The process failed to start, or restarted, too many times and was given
+	// up.
+	ProcessStatusFatal
 )
 
+// transitions lists the legal transitions from each state.
+var transitions = map[ProcessStatus][]ProcessStatus{
+	ProcessStatusIdle:     {ProcessStatusStarting},
+	ProcessStatusStarting: {ProcessStatusRunning, ProcessStatusBackoff, ProcessStatusStopping},
+	ProcessStatusRunning:  {ProcessStatusStopping, ProcessStatusExited},
+	ProcessStatusBackoff:  {ProcessStatusStarting, ProcessStatusStopped, ProcessStatusFatal},
+	ProcessStatusStopping: {ProcessStatusStopped},
+	ProcessStatusStopped:  {ProcessStatusStarting},
+	ProcessStatusExited:   {ProcessStatusStarting, ProcessStatusBackoff},
+	ProcessStatusFatal:    {ProcessStatusStarting},
+}
+
+// canTransition returns true if a process in state s can move to state to.
+func (s ProcessStatus) canTransition(to ProcessStatus) bool {
+	return slices.Contains(transitions[s], to)
+}
+
+// startRetryDelay is how long a process stays in backoff before its next
+// start attempt.
+const startRetryDelay = 100 * time.Millisecond
+
+// active returns true if the process has, or is about to have, a live child.
+func (s ProcessStatus) active() bool {
+	switch s {
+	case ProcessStatusStarting, ProcessStatusRunning, ProcessStatusBackoff, ProcessStatusStopping:
+		return true
+	}
+	return false
+}
+
+type requestKind int
+
+const (
+	requestStart requestKind = iota
+	requestStop
+	requestSignal
+	requestRestart
+)
+
+// request is an event sent to the supervisor goroutine of a process.
+type request struct {
+	kind  requestKind
+	reply chan error
+
+	// The signal to send, or the reason of the restart.
+	signal syscall.Signal
+	reason string
+}
+
+// Process is a single instance of a task. Its lifecycle is driven by its own
+// supervisor goroutine (see run), other goroutines only send it requests and
+// read its state.
 type Process struct {
+	name     string
+	taskName string
+	index    int
+	task     *Task
+	newCmd   func(ctx context.Context) (*exec.Cmd, error)
+	record   func(JobRun)
+	events   func(Event)
+	listener *eventListener
+
+	// Whether the process runs a scheduled task again while its instance is
+	// still running the previous run. It is removed once its run is over.
+	extra bool
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	requests chan request
+	stdout   *ringBuffer
+	stderr   *ringBuffer
+
+	// The output files of the task, nil if the output isn't saved.
+	stdoutLog *rotatingFile
+	stderrLog *rotatingFile
+
+	mu         sync.Mutex
 	cmd        *exec.Cmd
-	task       *Task
+	pid        int
 	startCount int
 	startAt    time.Time
+	spawns     int
+	exitPid    int
+	exitCode   int
+	exitSignal string
+	exitAt     time.Time
 	status     ProcessStatus
-	done       chan error
+	health     HealthStatus
+	statusText string
+	lastRun    JobRun
+	changed    chan struct{}
+
+	// The failed starts and the restarts of the process, for its metrics.
+	retries      int
+	autoRestarts int
+
+	// Owned by the supervisor goroutine.
+	exitC    chan error
+	timer    <-chan time.Time
+	stops    []chan error
+	killed   bool
+	restarts []time.Time
+	backoff  time.Duration
+
+	// Owned by the supervisor goroutine, alive with the child.
+	childCancel    context.CancelFunc
+	healthC        chan error
+	healthFailures int
+	restarting     bool
+	notifyC        chan string
+	ready          bool
+	watchdog       <-chan time.Time
+	deadline       <-chan time.Time
+	runOutput      *ringBuffer
 }
 
-func (p *Process) Start() error {
-	p.startAt = time.Now()
+func newProcess(ctx context.Context, name, taskName string, index int, task *Task, newCmd func(ctx context.Context) (*exec.Cmd, error), record func(JobRun), events func(Event), listener *eventListener, outputs *outputFiles) *Process {
+	p := &Process{
+		name:     name,
+		taskName: taskName,
+		index:    index,
+		task:     task,
+		newCmd:   newCmd,
+		record:   record,
+		events:   events,
+		listener: listener,
+		requests: make(chan request),
+		stdout:   newRingBuffer(outputBufferSize),
+		stderr:   newRingBuffer(outputBufferSize),
+		status:   ProcessStatusIdle,
+		changed:  make(chan struct{}),
+	}
+	if task.Stdout != "" && !isOutputTarget(task.Stdout) {
+		p.stdoutLog = outputs.file(task.Stdout, task.StdoutMaxBytes, task.StdoutBackups, task.LogCompress, task.LogMaxAge)
+	}
+	switch {
+	case task.Stderr == "", task.RedirectStderr, isOutputTarget(task.Stderr):
+	case task.Stderr == task.Stdout:
+		p.stderrLog = p.stdoutLog
+	default:
+		p.stderrLog = outputs.file(task.Stderr, task.StderrMaxBytes, task.StderrBackups, task.LogCompress, task.LogMaxAge)
+	}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	go p.run()
+
+	return p
+}
+
+// Status returns the current state of the process.
+func (p *Process) Status() ProcessStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// Pid returns the pid of the child if there is one alive.
+func (p *Process) Pid() (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pid == 0 {
+		return 0, ErrProcessIsNotRunning
+	}
+	return p.pid, nil
+}
+
+// LastRun returns the last finished run of a process running to completion.
+func (p *Process) LastRun() JobRun {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastRun
+}
+
+// setStatus moves the process to status. Illegal transitions are refused.
+func (p *Process) setStatus(status ProcessStatus) error {
+	return p.transition(status, "")
+}
+
+// transition moves the process to status and emits the event of the new
+// state, described by msg or by default.
+func (p *Process) transition(status ProcessStatus, msg string) error {
+	p.mu.Lock()
+	if !p.status.canTransition(status) {
+		slog.Error("illegal transition",
+			slog.String("process", p.name),
+			slog.String("from", p.status.String()),
+			slog.String("to", status.String()),
+		)
+		err := fmt.Errorf("%w: %s to %s", ErrInvalidTransition, p.status, status)
+		p.mu.Unlock()
+		return err
+	}
+	from := p.status
+	p.status = status
+	close(p.changed)
+	p.changed = make(chan struct{})
+	e, emit := p.stateEvent(from, status, msg)
+	p.mu.Unlock()
+
+	if emit && p.events != nil {
+		p.events(e)
+	}
+	return nil
+}
+
+// wait blocks until the process reaches one of the given states, or ctx is
+// done. It returns the last known state.
+func (p *Process) wait(ctx context.Context, states ...ProcessStatus) ProcessStatus {
+	status, _ := p.waitFor(ctx, func(status ProcessStatus, _ HealthStatus) bool {
+		return slices.Contains(states, status)
+	})
+	return status
+}
+
+// waitFor blocks until cond is true for the state and health of the process,
+// or ctx is done. It returns the last known state and health.
+func (p *Process) waitFor(ctx context.Context, cond func(ProcessStatus, HealthStatus) bool) (ProcessStatus, HealthStatus) {
+	for {
+		p.mu.Lock()
+		status, health, changed := p.status, p.health, p.changed
+		p.mu.Unlock()
+
+		if cond(status, health) {
+			return status, health
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return status, health
+		}
+	}
+}
+
+// send delivers a request to the supervisor goroutine and waits for its reply.
+func (p *Process) send(kind requestKind) error {
+	return p.sendRequest(request{kind: kind})
+}
+
+func (p *Process) sendRequest(req request) error {
+	req.reply = make(chan error, 1)
+	select {
+	case p.requests <- req:
+	case <-p.ctx.Done():
+		return ErrProcessIsNotRunning
+	}
+
+	select {
+	case err := <-req.reply:
+		return err
+	case <-p.ctx.Done():
+		return ErrProcessIsNotRunning
+	}
+}
+
+// retire ends the supervisor goroutine. A child still alive is killed.
+func (p *Process) retire() {
+	p.cancel()
+}
+
+// run is the supervisor loop of the process. It is the only goroutine
+// spawning, signaling and reaping the child.
+func (p *Process) run() {
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case req := <-p.requests:
+			p.handleRequest(req)
+		case err := <-p.exitC:
+			p.exitC = nil
+			p.handleExit(err)
+		case <-p.timer:
+			p.timer = nil
+			p.handleTimer()
+		case err := <-p.healthC:
+			p.handleHealth(err)
+		case msg := <-p.notifyC:
+			p.handleNotify(msg)
+		case <-p.watchdog:
+			p.watchdog = nil
+			p.restart("watchdog timeout")
+		case <-p.deadline:
+			p.deadline = nil
+			p.handleDeadline()
+		}
+	}
+}
+
+func (p *Process) handleRequest(req request) {
+	switch req.kind {
+	case requestStart:
+		if status := p.Status(); !status.canTransition(ProcessStatusStarting) {
+			if status.active() {
+				req.reply <- ErrProcessAlreadyStarted
+			} else {
+				req.reply <- fmt.Errorf("%w: %s to %s", ErrInvalidTransition, status, ProcessStatusStarting)
+			}
+			return
+		}
+		p.mu.Lock()
+		p.startCount = 0
+		p.mu.Unlock()
+		p.restarts = nil
+		p.backoff = 0
+		p.spawn()
+		req.reply <- nil
+
+	case requestStop:
+		switch p.Status() {
+		case ProcessStatusStarting, ProcessStatusRunning:
+			if err := p.signalStop(); err != nil {
+				req.reply <- err
+				return
+			}
+			p.stops = append(p.stops, req.reply)
+		case ProcessStatusStopping:
+			p.restarting = false
+			p.stops = append(p.stops, req.reply)
+		case ProcessStatusBackoff:
+			p.timer = nil
+			req.reply <- p.setStatus(ProcessStatusStopped)
+		default:
+			req.reply <- ErrProcessIsNotRunning
+		}
+
+	case requestSignal:
+		p.mu.Lock()
+		cmd, pid := p.cmd, p.pid
+		p.mu.Unlock()
+		if pid == 0 {
+			req.reply <- ErrProcessIsNotRunning
+			return
+		}
+		if err := cmd.Process.Signal(req.signal); err != nil {
+			req.reply <- fmt.Errorf("failed to send signal %s to task %s: %w", req.signal, p.name, err)
+			return
+		}
+		req.reply <- nil
+
+	case requestRestart:
+		switch p.Status() {
+		case ProcessStatusStarting, ProcessStatusRunning:
+			p.restart(req.reason)
+			req.reply <- nil
+		default:
+			req.reply <- ErrProcessIsNotRunning
+		}
+	}
+}
+
+// signalStop sends the stop signal to the child and moves the process to
+// Stopping. The child is killed if it is still alive after StopTime.
+func (p *Process) signalStop() error {
+	sig, err := p.task.stopSignal()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	cmd := p.cmd
+	p.mu.Unlock()
+	if err := cmd.Process.Signal(sig); err != nil {
+		return fmt.Errorf("failed to send signal %s to task %s: %w", sig, p.name, err)
+	}
+	if err := p.setStatus(ProcessStatusStopping); err != nil {
+		return err
+	}
+	p.killed = false
+	p.timer = time.After(p.task.StopTime)
+	return nil
+}
+
+// restart gracefully stops the child, a new one is spawned once it exited.
+func (p *Process) restart(reason string) {
+	switch p.Status() {
+	case ProcessStatusStarting, ProcessStatusRunning:
+	default:
+		return
+	}
+
+	slog.Warn("restart",
+		slog.String("process", p.name),
+		slog.String("reason", reason),
+	)
+	if err := p.signalStop(); err != nil {
+		slog.Error("restart failed",
+			slog.String("process", p.name),
+			slog.Any("error", err),
+		)
+		return
+	}
+	p.restarting = true
+	p.mu.Lock()
+	p.autoRestarts++
+	p.mu.Unlock()
+}
+
+// spawn starts a new child, moving the process to Starting, then to Backoff
+// or Fatal if the child could not be started.
+func (p *Process) spawn() {
+	if err := p.setStatus(ProcessStatusStarting); err != nil {
+		return
+	}
+
+	childCtx, childCancel := context.WithCancel(p.ctx)
+	cmd, err := p.newCmd(p.ctx)
+	if err == nil && p.task.Notify {
+		err = p.prepareNotify(childCtx, cmd)
+	}
+	if err == nil {
+		err = p.captureOutputs(cmd)
+	}
+	var listenerStdout *os.File
+	if err == nil && p.listener != nil {
+		listenerStdout, err = p.prepareListener(childCtx, cmd)
+	}
+	if err == nil {
+		if p.task.Umask != 0 {
+			oldUmask := syscall.Umask(p.task.Umask)
+			err = cmd.Start()
+			syscall.Umask(oldUmask)
+		} else {
+			err = cmd.Start()
+		}
+	}
+	if listenerStdout != nil {
+		// The child has its own copy, the listener reads until it exits.
+		listenerStdout.Close()
+	}
+
+	p.mu.Lock()
 	p.startCount++
-	if p.task.Umask != 0 {
-		oldUmask := syscall.Umask(p.task.Umask)
-		defer syscall.Umask(oldUmask)
+	p.startAt = time.Now()
+	p.statusText = ""
+	p.mu.Unlock()
+
+	if err != nil {
+		childCancel()
+		if cmd != nil {
+			closeOutputs(cmd)
+		}
+		p.notifyC = nil
+		slog.Error("spawn failed",
+			slog.String("process", p.name),
+			slog.Any("error", err),
+		)
+		p.retryStart()
+		return
+	}
+
+	p.mu.Lock()
+	p.cmd = cmd
+	p.pid = cmd.Process.Pid
+	p.spawns++
+	p.mu.Unlock()
+	slog.Info("spawned",
+		slog.String("process", p.name),
+		slog.Int("pid", cmd.Process.Pid),
+	)
+
+	exitC := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		closeOutputs(cmd)
+		exitC <- err
+	}()
+	p.exitC = exitC
+	p.childCancel = childCancel
+	if p.task.MaxRuntime > 0 {
+		p.deadline = time.After(p.task.MaxRuntime)
 	}
-	return p.cmd.Start()
+	if hc := p.task.HealthCheck; hc != nil {
+		p.healthC = make(chan error)
+		p.healthFailures = 0
+		p.setHealth(HealthStatusStarting)
+		go hc.healthLoop(childCtx, p.healthC)
+	}
+
+	if p.task.runsToCompletion() {
+		p.running()
+		return
+	}
+	p.timer = time.After(p.task.StartTime)
 }
 
-// ShouldRestart returns true if the process as successfully started and the
-// task is configured so.
-func (p Process) ShouldRestart() bool {
-	return p.cmd.ProcessState != nil &&
-		time.Since(p.startAt) > p.task.StartTime &&
-		p.task.shouldRestart(p.cmd.ProcessState.ExitCode()) && p.status != ProcessStatusStopped
+// retryStart moves a process that failed to start to Backoff, or to Fatal
+// once its start retries are exhausted.
+func (p *Process) retryStart() {
+	p.mu.Lock()
+	startCount := p.startCount
+	p.retries++
+	p.mu.Unlock()
+
+	p.setStatus(ProcessStatusBackoff)
+	if startCount < p.task.StartRetries {
+		p.timer = time.After(startRetryDelay)
+		return
+	}
+
+	p.transition(ProcessStatusFatal, fmt.Sprintf("gave up after %d tries", startCount))
+	slog.Error("gave up",
+		slog.String("process", p.name),
+		slog.Int("tries", startCount),
+	)
 }
 
-// ShouldRetryStart returns true if the process didn't start successfully and
-// the task is configured so.
-func (p Process) ShouldRetryStart() bool {
-	return p.startCount < p.task.StartRetries &&
-		p.cmd.ProcessState != nil &&
-		time.Since(p.startAt) < p.task.StartTime
+func (p *Process) handleExit(err error) {
+	p.mu.Lock()
+	exitCode := p.cmd.ProcessState.ExitCode()
+	startCount := p.startCount
+	p.exitPid = p.pid
+	p.pid = 0
+	p.exitCode = exitCode
+	p.exitSignal = ""
+	if ws, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		p.exitSignal = ws.Signal().String()
+	}
+	p.exitAt = time.Now()
+	p.mu.Unlock()
+
+	if p.task.runsToCompletion() {
+		p.recordRun()
+	}
+	p.childCancel()
+	p.healthC = nil
+	p.notifyC = nil
+	p.watchdog = nil
+	p.deadline = nil
+	p.setHealth(HealthStatusNone)
+
+	status := p.Status()
+	slog.Warn("exited",
+		slog.String("process", p.name),
+		slog.String("status", status.String()),
+		slog.Int("exit_code", exitCode),
+		slog.Int("start_count", startCount),
+		slog.Any("error", err),
+	)
+
+	switch status {
+	case ProcessStatusStopping:
+		p.timer = nil
+		p.setStatus(ProcessStatusStopped)
+		var reply error
+		if p.killed {
+			reply = fmt.Errorf("task %s was forcibly killed after timeout", p.name)
+		}
+		for _, stop := range p.stops {
+			stop <- reply
+		}
+		p.stops = nil
+
+		if p.restarting {
+			p.restarting = false
+			p.mu.Lock()
+			p.startCount = 0
+			p.mu.Unlock()
+			p.spawn()
+		}
+
+	case ProcessStatusStarting:
+		// Exited before StartTime, the start didn't succeed.
+		p.timer = nil
+		p.retryStart()
+
+	case ProcessStatusRunning:
+		p.setStatus(ProcessStatusExited)
+		if p.task.runsToCompletion() || !p.task.shouldRestart(exitCode) {
+			return
+		}
+		p.scheduleRestart()
+	}
+}
+
+// recordRun saves the run of the child which just exited.
+func (p *Process) recordRun() {
+	p.mu.Lock()
+	run := JobRun{
+		Process:    p.name,
+		Task:       p.taskName,
+		Start:      p.startAt,
+		End:        p.exitAt,
+		Duration:   p.exitAt.Sub(p.startAt).Truncate(time.Millisecond),
+		ExitCode:   p.exitCode,
+		ExitSignal: p.exitSignal,
+		Success:    p.exitSignal == "" && p.task.isExpectedExitCode(p.exitCode),
+		Output:     p.runOutput.String(),
+	}
+	p.lastRun = run
+	p.mu.Unlock()
+
+	if p.record != nil {
+		p.record(run)
+	}
+}
+
+// scheduleRestart moves an exited process to Backoff until its next restart,
+// or to Fatal if it restarted more than MaxRestarts times in RestartWindow.
+func (p *Process) scheduleRestart() {
+	now := time.Now()
+	p.restarts = slices.DeleteFunc(p.restarts, func(t time.Time) bool {
+		return now.Sub(t) > p.task.RestartWindow
+	})
+	p.restarts = append(p.restarts, now)
+
+	p.mu.Lock()
+	p.startCount = 0
+	ranFor := now.Sub(p.startAt)
+	p.mu.Unlock()
+
+	p.setStatus(ProcessStatusBackoff)
+	if p.task.MaxRestarts > 0 && len(p.restarts) > p.task.MaxRestarts {
+		p.transition(ProcessStatusFatal, fmt.Sprintf("crash loop, gave up after %d restarts", len(p.restarts)-1))
+		slog.Error("crash loop, gave up",
+			slog.String("process", p.name),
+			slog.Int("restarts", len(p.restarts)-1),
+			slog.Duration("window", p.task.RestartWindow),
+		)
+		return
+	}
+
+	p.mu.Lock()
+	p.autoRestarts++
+	p.mu.Unlock()
+
+	if ranFor >= p.task.Backoff.Reset {
+		p.backoff = 0
+	}
+	p.backoff = p.task.Backoff.next(p.backoff)
+	delay := p.task.Backoff.jitter(p.backoff)
+	slog.Info("restarting",
+		slog.String("process", p.name),
+		slog.Duration("delay", delay),
+	)
+	p.timer = time.After(delay)
+}
+
+func (p *Process) handleTimer() {
+	switch p.Status() {
+	case ProcessStatusStarting:
+		if p.task.Notify && !p.ready {
+			slog.Error("not ready after starttime",
+				slog.String("process", p.name),
+			)
+			p.mu.Lock()
+			cmd := p.cmd
+			p.mu.Unlock()
+			cmd.Process.Kill()
+			return
+		}
+		p.running()
+	case ProcessStatusBackoff:
+		p.spawn()
+	case ProcessStatusStopping:
+		// Timeout reached, force kill
+		p.mu.Lock()
+		cmd := p.cmd
+		p.mu.Unlock()
+		if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			slog.Error("failed to kill",
+				slog.String("process", p.name),
+				slog.Any("error", err),
+			)
+		}
+		p.killed = true
+	}
+}
+
+// handleDeadline stops a process running for longer than its MaxRuntime.
+func (p *Process) handleDeadline() {
+	switch p.Status() {
+	case ProcessStatusStarting, ProcessStatusRunning:
+	default:
+		return
+	}
+
+	slog.Warn("max runtime exceeded",
+		slog.String("process", p.name),
+		slog.Duration("max_runtime", p.task.MaxRuntime),
+	)
+	p.restarting = false
+	if err := p.signalStop(); err != nil {
+		slog.Error("stop failed",
+			slog.String("process", p.name),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// running moves a starting process to Running.
+func (p *Process) running() {
+	p.mu.Lock()
+	pid, tries := p.pid, p.startCount
+	p.mu.Unlock()
+	p.setStatus(ProcessStatusRunning)
+	slog.Info("success",
+		slog.String("process", p.name),
+		slog.Int("pid", pid),
+		slog.Int("tries", tries),
+	)
+}
+
+// captureOutputs copies the outputs of the child to the buffers and the
+// files of the process, and to the output of the run for a program running
+// to completion.
+func (p *Process) captureOutputs(cmd *exec.Cmd) error {
+	stdout := &teeOutput{tees: []io.Writer{p.stdout}}
+	stderr := &teeOutput{tees: []io.Writer{p.stderr}}
+
+	var err error
+	stdout.w, err = p.openOutput(p.task.Stdout, p.stdoutLog, OutputStdout)
+	if err != nil {
+		return err
+	}
+	if !p.task.RedirectStderr {
+		stderr.w, err = p.openOutput(p.task.Stderr, p.stderrLog, OutputStderr)
+		if err != nil {
+			stdout.Close()
+			return err
+		}
+	}
+	if p.task.runsToCompletion() {
+		p.runOutput = newRingBuffer(outputTailSize)
+		stdout.tees = append(stdout.tees, p.runOutput)
+		stderr.tees = append(stderr.tees, p.runOutput)
+	}
+	if p.listener == nil {
+		// The standard output of a listener is its protocol.
+		cmd.Stdout = stdout
+	}
+	cmd.Stderr = stderr
+	if p.task.RedirectStderr {
+		// A single pipe, as with 2>&1, keeps the order of the lines.
+		cmd.Stderr = stdout
+	}
+
+	// The outputs are now pipes, don't wait for a grandchild holding them
+	// once the child exited.
+	cmd.WaitDelay = time.Second
+	return nil
+}
+
+// openOutput opens the destination of a stream of the child: nothing, a
+// syslog or journald target, or the log file.
+func (p *Process) openOutput(output string, log *rotatingFile, stream string) (io.Writer, error) {
+	switch {
+	case output == "":
+		return nil, nil
+	case isOutputTarget(output):
+		return p.dialOutput(output, stream)
+	default:
+		if err := log.open(); err != nil {
+			return nil, err
+		}
+		return p.decorate(log, stream), nil
+	}
+}
+
+// decorate wraps an output file of the process to prefix its lines, if its
+// task asks for it.
+func (p *Process) decorate(w io.Writer, stream string) io.Writer {
+	if !p.task.LogTimestamp && !p.task.LogPrefix {
+		return w
+	}
+	return &lineWriter{w: w, prefix: p.linePrefix(stream)}
+}
+
+// closeOutputs closes the files opened by captureOutputs for the child
+// outputs.
+func closeOutputs(cmd *exec.Cmd) {
+	for _, w := range []io.Writer{cmd.Stdout, cmd.Stderr} {
+		if c, ok := w.(io.Closer); ok {
+			c.Close()
+		}
+	}
 }
@@ -0,0 +1,48 @@
+package taskmaster
+
+import (
+	"testing"
+)
+
+func TestProcessStatusCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to ProcessStatus
+		want     bool
+	}{
+		{ProcessStatusIdle, ProcessStatusStarting, true},
+		{ProcessStatusIdle, ProcessStatusRunning, false},
+		{ProcessStatusStarting, ProcessStatusRunning, true},
+		{ProcessStatusStarting, ProcessStatusFatal, false},
+		{ProcessStatusBackoff, ProcessStatusFatal, true},
+		{ProcessStatusRunning, ProcessStatusBackoff, false},
+		{ProcessStatusExited, ProcessStatusBackoff, true},
+		{ProcessStatusStopping, ProcessStatusStarting, false},
+		{ProcessStatusStopped, ProcessStatusStarting, true},
+		{ProcessStatusFatal, ProcessStatusStarting, true},
+		{ProcessStatusUnknown, ProcessStatusStarting, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.from.canTransition(tt.to); got != tt.want {
+			t.Errorf("%s -> %s: expected %v, got %v", tt.from, tt.to, tt.want, got)
+		}
+	}
+}
+
+func TestProcessSetStatusRefusesIllegalTransition(t *testing.T) {
+	p := &Process{
+		name:    "test",
+		status:  ProcessStatusIdle,
+		changed: make(chan struct{}),
+	}
+
+	if err := p.setStatus(ProcessStatusRunning); err == nil {
+		t.Error("Expected Idle -> Running to be refused")
+	}
+	if p.Status() != ProcessStatusIdle {
+		t.Errorf("Expected process to stay Idle, got %s", p.Status())
+	}
+	if err := p.setStatus(ProcessStatusStarting); err != nil {
+		t.Errorf("Expected Idle -> Starting to be accepted, got %v", err)
+	}
+}
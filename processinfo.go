@@ -0,0 +1,136 @@
+package taskmaster
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// ProcessInfo is a snapshot of the state of a process.
+type ProcessInfo struct {
+	Name        string
+	Task        string
+	Index       int
+	State       ProcessStatus
+	Health      HealthStatus
+	Pid         int
+	StartTime   time.Time
+	Uptime      time.Duration
+	StartCount  int
+	Restarts    int
+	Retries     int
+	ExitCode    int
+	ExitSignal  string
+	ExitTime    time.Time
+	Stdout      string
+	Stderr      string
+	StatusText  string
+	NextRun     time.Time
+	LastRun     time.Time
+	Description string
+
+	// The last sample of the resources used by the child, nil without one.
+	Stats *ProcessStats
+}
+
+// Info returns a snapshot of the state of the process.
+func (p *Process) Info() ProcessInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info := ProcessInfo{
+		Name:       p.name,
+		Task:       p.taskName,
+		Index:      p.index,
+		State:      p.status,
+		Health:     p.health,
+		Pid:        p.pid,
+		StartTime:  p.startAt,
+		StartCount: p.spawns,
+		Restarts:   p.autoRestarts,
+		Retries:    p.retries,
+		ExitCode:   p.exitCode,
+		ExitSignal: p.exitSignal,
+		ExitTime:   p.exitAt,
+		Stdout:     p.task.Stdout,
+		Stderr:     p.task.Stderr,
+		StatusText: p.statusText,
+	}
+	if p.pid != 0 {
+		info.Uptime = time.Since(p.startAt).Truncate(time.Second)
+	}
+	info.Description = info.describe()
+
+	return info
+}
+
+// describe returns a human readable line about the state, in the fashion of
+// supervisorctl.
+func (i ProcessInfo) describe() string {
+	desc := i.describeState()
+	if i.NextRun.IsZero() {
+		return desc
+	}
+
+	schedule := "next run " + i.NextRun.Format(time.DateTime)
+	if !i.LastRun.IsZero() {
+		schedule += ", last run " + i.LastRun.Format(time.DateTime)
+	}
+	if desc == "" {
+		return schedule
+	}
+	return desc + ", " + schedule
+}
+
+func (i ProcessInfo) describeState() string {
+	switch i.State {
+	case ProcessStatusIdle:
+		return "Not started"
+	case ProcessStatusStarting, ProcessStatusRunning, ProcessStatusStopping:
+		if i.StatusText != "" {
+			return fmt.Sprintf("pid %d, uptime %s, %s", i.Pid, i.Uptime, i.StatusText)
+		}
+		return fmt.Sprintf("pid %d, uptime %s", i.Pid, i.Uptime)
+	case ProcessStatusBackoff:
+		return "Waiting before next start"
+	case ProcessStatusFatal:
+		return "Failed too many times, gave up"
+	case ProcessStatusStopped, ProcessStatusExited:
+		if i.ExitTime.IsZero() {
+			return ""
+		}
+		if i.ExitSignal != "" {
+			return fmt.Sprintf("%s, %s", i.ExitTime.Format(time.DateTime), i.ExitSignal)
+		}
+		return fmt.Sprintf("%s, exit code %d", i.ExitTime.Format(time.DateTime), i.ExitCode)
+	default:
+		return ""
+	}
+}
+
+// WriteInfoTable writes infos as a table to w.
+func WriteInfoTable(w io.Writer, infos []ProcessInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATE\tHEALTH\tPID\tUPTIME\tSTARTS\tDESCRIPTION")
+	for _, info := range infos {
+		health, pid, uptime := "-", "-", "-"
+		if info.Health != HealthStatusNone {
+			health = info.Health.String()
+		}
+		if info.Pid != 0 {
+			pid = fmt.Sprint(info.Pid)
+			uptime = info.Uptime.String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			info.Name,
+			info.State,
+			health,
+			pid,
+			uptime,
+			info.StartCount,
+			info.Description,
+		)
+	}
+	return tw.Flush()
+}
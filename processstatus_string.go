@@ -9,16 +9,19 @@ func _() {
 	// Re-run the stringer command to generate them again.
 	var x [1]struct{}
 	_ = x[ProcessStatusUnknown-0]
-	_ = x[ProcessStatusRunning-1]
-	_ = x[ProcessStatusExited-2]
-	_ = x[ProcessStatusStopped-3]
-	_ = x[ProcessStatusIdle-4]
-	_ = x[ProcessStatusFailed-5]
+	_ = x[ProcessStatusIdle-1]
+	_ = x[ProcessStatusStarting-2]
+	_ = x[ProcessStatusRunning-3]
+	_ = x[ProcessStatusBackoff-4]
+	_ = x[ProcessStatusStopping-5]
+	_ = x[ProcessStatusStopped-6]
+	_ = x[ProcessStatusExited-7]
+	_ = x[ProcessStatusFatal-8]
 }
 
-const _ProcessStatus_name = "UnknownRunningExitedStoppedIdleFailed"
+const _ProcessStatus_name = "UnknownIdleStartingRunningBackoffStoppingStoppedExitedFatal"
 
-var _ProcessStatus_index = [...]uint8{0, 7, 14, 20, 27, 31, 37}
+var _ProcessStatus_index = [...]uint8{0, 7, 11, 19, 26, 33, 41, 48, 54, 59}
 
 func (i ProcessStatus) String() string {
 	if i < 0 || i >= ProcessStatus(len(_ProcessStatus_index)-1) {
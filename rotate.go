@@ -0,0 +1,320 @@
+package taskmaster
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ByteSize is a size in bytes, read from yaml as a number or with a unit:
+// 512KB, 10MB, 1GB. The units are binary, so 512KiB is read as 512KB.
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   ByteSize
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	value := strings.ToUpper(strings.TrimSpace(node.Value))
+	if n, found := strings.CutSuffix(value, "IB"); found {
+		value = n + "B"
+	}
+	unit := ByteSize(1)
+	for _, u := range byteSizeUnits {
+		if n, found := strings.CutSuffix(value, u.suffix); found {
+			value, unit = strings.TrimSpace(n), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size: %s", node.Value)
+	}
+	*b = ByteSize(n) * unit
+	return nil
+}
+
+// String returns the size with the largest unit it holds: 1.5MB.
+func (b ByteSize) String() string {
+	for _, u := range byteSizeUnits[:len(byteSizeUnits)-1] {
+		if b >= u.size {
+			return strconv.FormatFloat(float64(b)/float64(u.size), 'f', 1, 64) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
+
+// rotatingFile is an output file of a process, rotated once it reaches
+// maxBytes. It is opened on the first write after being closed.
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	backups  int
+	compress bool
+	maxAge   time.Duration
+	// perm is the mode of a created file, 0644 if zero.
+	perm os.FileMode
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+
+	// onOpen, if set, is called with f.mu held each time the file is opened.
+	onOpen func(*os.File)
+}
+
+func newRotatingFile(path string, maxBytes ByteSize, backups int, compress bool, maxAge time.Duration) *rotatingFile {
+	return &rotatingFile{
+		path:     path,
+		maxBytes: int64(maxBytes),
+		backups:  backups,
+		compress: compress,
+		maxAge:   maxAge,
+	}
+}
+
+// outputFiles holds the output files of the processes by path, so that the
+// instances of a task, or tasks, writing to the same file share its size and
+// its rotation.
+type outputFiles struct {
+	mu    sync.Mutex
+	files map[string]*rotatingFile
+}
+
+// file returns the output file at path, made with the given settings or
+// updated to them.
+func (o *outputFiles) file(path string, maxBytes ByteSize, backups int, compress bool, maxAge time.Duration) *rotatingFile {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.files == nil {
+		o.files = make(map[string]*rotatingFile)
+	}
+	f, exists := o.files[path]
+	if !exists {
+		f = newRotatingFile(path, maxBytes, backups, compress, maxAge)
+		o.files[path] = f
+		return f
+	}
+	f.mu.Lock()
+	f.maxBytes, f.backups, f.compress, f.maxAge = int64(maxBytes), backups, compress, maxAge
+	f.mu.Unlock()
+	return f
+}
+
+// prune forgets the files none of tasks writes to.
+func (o *outputFiles) prune(tasks map[string]*Task) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for path := range o.files {
+		used := false
+		for _, task := range tasks {
+			if task.Stdout == path || task.Stderr == path {
+				used = true
+				break
+			}
+		}
+		if !used {
+			delete(o.files, path)
+		}
+	}
+}
+
+// open opens the file if it isn't.
+func (f *rotatingFile) open() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.openLocked()
+}
+
+func (f *rotatingFile) openLocked() error {
+	if f.file != nil {
+		return nil
+	}
+
+	perm := f.perm
+	if perm == 0 {
+		perm = 0644
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, perm)
+	if err != nil {
+		return fmt.Errorf("failed to open output file %s: %w", f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open output file %s: %w", f.path, err)
+	}
+	f.file = file
+	f.size = info.Size()
+	if f.onOpen != nil {
+		f.onOpen(file)
+	}
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotateLocked(); err != nil {
+			return 0, err
+		}
+	}
+	if err := f.openLocked(); err != nil {
+		return 0, err
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the file, the next write opens it again.
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// rotate moves the file to its first backup, shifting the others. Without
+// backups, the file is removed.
+func (f *rotatingFile) rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotateLocked()
+}
+
+func (f *rotatingFile) rotateLocked() error {
+	wasOpen := f.file != nil
+	if wasOpen {
+		f.file.Close()
+		f.file = nil
+	}
+	f.size = 0
+
+	var err error
+	if f.backups <= 0 {
+		err = os.Remove(f.path)
+	} else {
+		err = f.shiftBackups()
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to rotate %s: %w", f.path, err)
+	}
+	f.prune()
+
+	if wasOpen {
+		return f.openLocked()
+	}
+	return nil
+}
+
+func (f *rotatingFile) backup(i int) string {
+	if f.compress {
+		return fmt.Sprintf("%s.%d.gz", f.path, i)
+	}
+	return fmt.Sprintf("%s.%d", f.path, i)
+}
+
+func (f *rotatingFile) shiftBackups() error {
+	os.Remove(f.backup(f.backups))
+	for i := f.backups - 1; i >= 1; i-- {
+		os.Rename(f.backup(i), f.backup(i+1))
+	}
+
+	if !f.compress {
+		return os.Rename(f.path, f.backup(1))
+	}
+	rotated := fmt.Sprintf("%s.1", f.path)
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+	return gzipFile(rotated, f.backup(1))
+}
+
+// prune removes the backups older than maxAge.
+func (f *rotatingFile) prune() {
+	if f.maxAge <= 0 {
+		return
+	}
+	for i := 1; i <= f.backups; i++ {
+		info, err := os.Stat(f.backup(i))
+		if err == nil && time.Since(info.ModTime()) > f.maxAge {
+			os.Remove(f.backup(i))
+		}
+	}
+}
+
+// gzipFile compresses src to dst and removes src.
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// LogRotate forces the rotation of the output files of a process.
+//
+// Parameters:
+//   - name: the name of the process.
+func (s *Service) LogRotate(name string) error {
+	process, err := s.process(name)
+	if err != nil {
+		return err
+	}
+	if process.stdoutLog == nil && process.stderrLog == nil {
+		return ErrProcessNoLogFile
+	}
+
+	var errs []error
+	if process.stdoutLog != nil {
+		errs = append(errs, process.stdoutLog.rotate())
+	}
+	if process.stderrLog != nil && process.stderrLog != process.stdoutLog {
+		errs = append(errs, process.stderrLog.rotate())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,181 @@
+package taskmaster
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestByteSizeUnmarshal(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ByteSize
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"512KB", 512 << 10, false},
+		{"10 MB", 10 << 20, false},
+		{"512MiB", 512 << 20, false},
+		{"1gb", 1 << 30, false},
+		{"12B", 12, false},
+		{"-1", 0, true},
+		{"ten", 0, true},
+	}
+
+	for _, tt := range tests {
+		var v struct {
+			Size ByteSize `yaml:"size"`
+		}
+		err := yaml.Unmarshal([]byte("size: "+tt.in), &v)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: expected error %v, got %v", tt.in, tt.wantErr, err)
+			continue
+		}
+		if !tt.wantErr && v.Size != tt.want {
+			t.Errorf("%q: expected %d, got %d", tt.in, tt.want, v.Size)
+		}
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	f := newRotatingFile(path, 10, 2, false, 0)
+	defer f.Close()
+
+	for _, line := range []string{"first...\n", "second..\n", "third...\n", "fourth..\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for file, want := range map[string]string{
+		path:        "fourth..\n",
+		path + ".1": "third...\n",
+		path + ".2": "second..\n",
+	} {
+		if data, _ := os.ReadFile(file); string(data) != want {
+			t.Errorf("%s: expected %q, got %q", file, want, data)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Expected no more than 2 backups")
+	}
+}
+
+func TestRotatingFileCompress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	f := newRotatingFile(path, 0, 1, true, 0)
+	defer f.Close()
+
+	f.Write([]byte("hello\n"))
+	if err := f.rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path + ".1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(zr); string(data) != "hello\n" {
+		t.Errorf("Expected the rotated content, got %q", data)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Error("Expected the uncompressed backup to be removed")
+	}
+}
+
+func TestService_LogRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"logger": {
+				Cmd:           "sh",
+				Args:          []string{"-c", "echo before; sleep 1; echo after; sleep 10"},
+				NumProcs:      1,
+				StartRetries:  1,
+				StartTime:     time.Millisecond * 100,
+				StopTime:      time.Second,
+				Stdout:        path,
+				StdoutBackups: 1,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if err := s.StartWait("logger"); err != nil {
+		t.Fatalf("Expected StartWait to succeed, got %v", err)
+	}
+	_, offset, _ := s.Tail("logger", OutputStdout, 10)
+	if err := s.LogRotate("logger"); err != nil {
+		t.Fatalf("Expected LogRotate to succeed, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if out, _, _ := s.Follow(ctx, "logger", OutputStdout, offset); !strings.Contains(out, "after") {
+		t.Fatalf("Expected more output, got %q", out)
+	}
+
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "before\n" {
+		t.Errorf("Expected the rotated file to hold %q, got %q", "before\n", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "after\n" {
+		t.Errorf("Expected the new file to hold %q, got %q", "after\n", data)
+	}
+}
+
+func TestService_LogRotateShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"logger": {
+				Cmd:           "sh",
+				Args:          []string{"-c", "echo before; sleep 1; echo after; sleep 10"},
+				NumProcs:      2,
+				StartRetries:  1,
+				StartTime:     time.Millisecond * 100,
+				StopTime:      time.Second,
+				Stdout:        path,
+				StdoutBackups: 1,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if err := s.Batch(s.StartWait, []string{"logger_00", "logger_01"}); err != nil {
+		t.Fatalf("Expected StartWait to succeed, got %v", err)
+	}
+	if err := s.LogRotate("logger_00"); err != nil {
+		t.Fatalf("Expected LogRotate to succeed, got %v", err)
+	}
+
+	// Both instances move to the new file, rotated once.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if string(data) == "after\nafter\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the new file to hold the output of both instances, got %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "before\nbefore\n" {
+		t.Errorf("Expected the rotated file to hold %q, got %q", "before\nbefore\n", data)
+	}
+}
@@ -2,6 +2,8 @@ package taskmaster
 
 //go:generate go run ./cmd/rpc_method_const/ -type RPCService
 
+import "log/slog"
+
 // RPCService will be the type on which we define our RPC methods
 type RPCService struct {
 	service *Service
@@ -25,7 +27,7 @@ func (r *RPCService) List(_ struct{}, names *[]string) error {
 	return nil
 }
 
-// Start starts a service by name.
+// Start starts a service by name and waits until it is running.
 //
 // Parameters:
 //   - name: The name of the service to start.
@@ -33,7 +35,7 @@ func (r *RPCService) List(_ struct{}, names *[]string) error {
 // Returns:
 //   - An error if the start operation fails.
 func (r *RPCService) Start(name string, _ *struct{}) error {
-	return r.service.Start(name)
+	return r.service.StartWait(name)
 }
 
 // Stop stops a service by name.
@@ -61,13 +63,170 @@ func (r *RPCService) ReloadConfig(_ struct{}, reply *bool) error {
 	return err
 }
 
-func (r *RPCService) Status(name string, status *ProcessStatus) error {
-	*status = r.service.Status(name)
+// Info retrieves the state of a process.
+//
+// Parameters:
+//   - name: The name of the process.
+//   - info: A pointer to a ProcessInfo where the state will be stored.
+//
+// Returns:
+//   - An error if the process doesn't exist.
+func (r *RPCService) Info(name string, info *ProcessInfo) error {
+	var err error
+	*info, err = r.service.Info(name)
+	return err
+}
+
+// InfoAll retrieves the state of every process, sorted by name.
+//
+// Parameters:
+//   - _: An empty struct, as this method does not require any input parameters.
+//   - infos: A pointer to a slice where the states will be stored.
+//
+// Returns:
+//   - An error if the retrieval fails.
+func (r *RPCService) InfoAll(_ struct{}, infos *[]ProcessInfo) error {
+	*infos = r.service.InfoAll()
 	return nil
 }
 
-func (r *RPCService) GetPid(name string, pid *int) error {
+// Run starts a process running to completion, or all the processes of a
+// task, and waits for them to finish.
+//
+// Parameters:
+//   - name: The name of the process or of the task to run.
+//   - runs: A pointer to a slice where the finished runs will be stored.
+//
+// Returns:
+//   - An error if a process couldn't be run.
+func (r *RPCService) Run(name string, runs *[]JobRun) error {
+	var err error
+	*runs, err = r.service.Run(name)
+	return err
+}
+
+// History retrieves the last runs of a task, oldest first.
+//
+// Parameters:
+//   - taskName: The name of the task.
+//   - runs: A pointer to a slice where the runs will be stored.
+//
+// Returns:
+//   - An error if the task doesn't exist.
+func (r *RPCService) History(taskName string, runs *[]JobRun) error {
+	var err error
+	*runs, err = r.service.History(taskName)
+	return err
+}
+
+// Tail retrieves the last lines of an output stream of a process, or follows
+// it from an offset.
+//
+// Parameters:
+//   - args: The process, the stream, and either the number of lines or the
+//     offset to follow from.
+//   - reply: A pointer to a TailReply where the output and the next offset
+//     will be stored.
+//
+// Returns:
+//   - An error if the process or the stream doesn't exist.
+func (r *RPCService) Tail(args TailArgs, reply *TailReply) error {
+	var err error
+	if args.Follow {
+		reply.Output, reply.Offset, err = r.service.Follow(r.service.Ctx, args.Name, args.Stream, args.Offset)
+	} else {
+		reply.Output, reply.Offset, err = r.service.Tail(args.Name, args.Stream, args.Lines)
+	}
+	return err
+}
+
+// MainTail retrieves the last lines logged by the service, or follows them
+// from an offset.
+//
+// Parameters:
+//   - args: Either the number of lines or the offset to follow from. The
+//     process and the stream are ignored.
+//   - reply: A pointer to a TailReply where the lines and the next offset
+//     will be stored.
+//
+// Returns:
+//   - An error if the service doesn't keep its logs.
+func (r *RPCService) MainTail(args TailArgs, reply *TailReply) error {
+	var err error
+	if args.Follow {
+		reply.Output, reply.Offset, err = r.service.MainFollow(r.service.Ctx, args.Offset)
+	} else {
+		reply.Output, reply.Offset, err = r.service.MainTail(args.Lines)
+	}
+	return err
+}
+
+// Events returns the sequence number to follow the events from, or follows
+// them from a sequence number. The call returns as soon as there are events,
+// or with none after a while, for the caller to call it again.
+//
+// Parameters:
+//   - args: The filter of the events, and the sequence number to follow
+//     them from.
+//   - reply: A pointer to an EventsReply where the events and the next
+//     sequence number will be stored.
+//
+// Returns:
+//   - Always nil.
+func (r *RPCService) Events(args EventsArgs, reply *EventsReply) error {
+	if !args.Follow {
+		reply.Seq = r.service.LastEvent()
+		return nil
+	}
+
+	reply.Events, reply.Seq = r.service.FollowEvents(r.service.Ctx, args.Seq, args.Filter)
+	return nil
+}
+
+// LogRotate forces the rotation of the output files of a process.
+//
+// Parameters:
+//   - name: The name of the process.
+//
+// Returns:
+//   - An error if the process has no output file or the rotation fails.
+func (r *RPCService) LogRotate(name string, _ *struct{}) error {
+	return r.service.LogRotate(name)
+}
+
+// LogLevel returns the minimum level of the logs, after changing it if level
+// isn't empty.
+//
+// Parameters:
+//   - level: The new level: debug, info, warn or error, or empty.
+//   - reply: The current level.
+//
+// Returns:
+//   - An error if the level is unknown.
+func (r *RPCService) LogLevel(level string, reply *string) error {
+	if level != "" {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return err
+		}
+		r.service.SetLogLevel(l)
+	}
+
+	*reply = r.service.LogLevel().String()
+	return nil
+}
+
+// Stats retrieves the last samples of the resources used by a process,
+// oldest first.
+//
+// Parameters:
+//   - name: The name of the process.
+//   - stats: A pointer to a slice where the samples will be stored.
+//
+// Returns:
+//   - An error if the process doesn't exist.
+func (r *RPCService) Stats(name string, stats *[]ProcessStats) error {
 	var err error
-	*pid, err = r.service.GetPid(name)
+	*stats, err = r.service.Stats(name)
 	return err
 }
@@ -7,6 +7,14 @@ const (
 	RPCServiceStart        = "RPCService.Start"
 	RPCServiceStop         = "RPCService.Stop"
 	RPCServiceReloadConfig = "RPCService.ReloadConfig"
-	RPCServiceStatus       = "RPCService.Status"
-	RPCServiceGetPid       = "RPCService.GetPid"
+	RPCServiceInfo         = "RPCService.Info"
+	RPCServiceInfoAll      = "RPCService.InfoAll"
+	RPCServiceRun          = "RPCService.Run"
+	RPCServiceHistory      = "RPCService.History"
+	RPCServiceTail         = "RPCService.Tail"
+	RPCServiceMainTail     = "RPCService.MainTail"
+	RPCServiceEvents       = "RPCService.Events"
+	RPCServiceLogRotate    = "RPCService.LogRotate"
+	RPCServiceLogLevel     = "RPCService.LogLevel"
+	RPCServiceStats        = "RPCService.Stats"
 )
@@ -0,0 +1,319 @@
+package taskmaster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	ConcurrencyAllow   concurrencyPolicy = "allow"
+	ConcurrencyForbid  concurrencyPolicy = "forbid"
+	ConcurrencyReplace concurrencyPolicy = "replace"
+
+	MissedRunSkip missedRunPolicy = "skip"
+	MissedRunOnce missedRunPolicy = "runonce"
+)
+
+// extraProcessFormat names the extra instances started by the allow
+// concurrency policy, after the instance still running.
+const extraProcessFormat = "%s.run%d"
+
+type concurrencyPolicy string
+
+type missedRunPolicy string
+
+// scheduler starts the processes of a task on its schedule.
+type scheduler struct {
+	taskName string
+	task     *Task
+	spec     cronSchedule
+	cancel   context.CancelFunc
+
+	// The state file of the config the scheduler was made with, as the
+	// config is replaced on reload.
+	stateFile string
+
+	mu   sync.Mutex
+	next time.Time
+	last time.Time
+}
+
+// checkSchedule verifies the scheduling settings of task name and sets their
+// defaults.
+func (t *Task) checkSchedule(name string) error {
+	if t.Schedule == "" {
+		return nil
+	}
+	if _, err := parseSchedule(t.Schedule); err != nil {
+		return fmt.Errorf("config: task %s: invalid schedule: %w", name, err)
+	}
+
+	switch t.Concurrency {
+	case "":
+		t.Concurrency = ConcurrencyForbid
+	case ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace:
+	default:
+		return fmt.Errorf("config: task %s: unknown concurrency policy: %s", name, t.Concurrency)
+	}
+
+	switch t.MissedRuns {
+	case "":
+		t.MissedRuns = MissedRunSkip
+	case MissedRunSkip, MissedRunOnce:
+	default:
+		return fmt.Errorf("config: task %s: unknown missed runs policy: %s", name, t.MissedRuns)
+	}
+	return nil
+}
+
+// runsToCompletion returns true if the program is expected to exit on its
+// own, it is then running as soon as spawned, never restarted, and its runs
+// are kept in the history.
+func (t Task) runsToCompletion() bool {
+	return t.Type == TaskTypeOneshot || t.Schedule != ""
+}
+
+// makeSchedulers starts a scheduler for each scheduled task. The last run of
+// previous schedulers is kept. It is called with s.mu held, or before the
+// service is shared.
+func (s *Service) makeSchedulers(tasks map[string]*Task, previous map[string]*scheduler) map[string]*scheduler {
+	schedulers := make(map[string]*scheduler)
+	stateFile := s.cfg.StateFile
+
+	for taskName, task := range tasks {
+		if task.Schedule == "" {
+			continue
+		}
+		spec, err := parseSchedule(task.Schedule)
+		if err != nil {
+			slog.Error("invalid schedule",
+				slog.String("task", taskName),
+				slog.Any("error", err),
+			)
+			continue
+		}
+
+		sc := &scheduler{
+			taskName:  taskName,
+			task:      task,
+			spec:      spec,
+			stateFile: stateFile,
+			next:      spec.next(time.Now()),
+			last:      s.lastRun(stateFile, taskName),
+		}
+		if prev, exists := previous[taskName]; exists {
+			sc.last = prev.lastRun()
+		}
+		var ctx context.Context
+		ctx, sc.cancel = context.WithCancel(s.Ctx)
+		schedulers[taskName] = sc
+		go s.runScheduler(ctx, sc)
+	}
+
+	return schedulers
+}
+
+func (sc *scheduler) nextRun() time.Time {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.next
+}
+
+func (sc *scheduler) lastRun() time.Time {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.last
+}
+
+// runScheduler fires the task on its schedule until ctx is done.
+func (s *Service) runScheduler(ctx context.Context, sc *scheduler) {
+	if sc.task.MissedRuns == MissedRunOnce {
+		last := sc.lastRun()
+		if !last.IsZero() {
+			if missed := sc.spec.next(last); !missed.IsZero() && missed.Before(time.Now()) {
+				slog.Info("missed run",
+					slog.String("task", sc.taskName),
+					slog.Time("at", missed),
+				)
+				s.fire(sc)
+			}
+		}
+	}
+
+	next := sc.nextRun()
+	for !next.IsZero() {
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		s.fire(sc)
+
+		next = sc.spec.next(time.Now())
+		sc.mu.Lock()
+		sc.next = next
+		sc.mu.Unlock()
+	}
+}
+
+// fire starts a run of the task following its concurrency policy.
+func (s *Service) fire(sc *scheduler) {
+	now := time.Now()
+	sc.mu.Lock()
+	sc.last = now
+	sc.mu.Unlock()
+	s.saveLastRun(sc.stateFile, sc.taskName, now)
+
+	processes := s.taskProcesses(sc.taskName)
+	var names, active []string
+	for name, process := range processes {
+		if process.Status().active() {
+			active = append(active, name)
+		}
+		if !process.extra {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	switch sc.task.Concurrency {
+	case ConcurrencyForbid:
+		if len(active) > 0 {
+			slog.Warn("scheduled run skipped, previous run still active",
+				slog.String("task", sc.taskName),
+			)
+			return
+		}
+	case ConcurrencyReplace:
+		if err := s.Batch(s.Stop, active); err != nil {
+			slog.Error("replace previous run", slog.Any("Batch", err))
+		}
+	}
+
+	slog.Info("scheduled run",
+		slog.String("task", sc.taskName),
+	)
+	for _, name := range names {
+		err := processes[name].send(requestStart)
+		if errors.Is(err, ErrProcessAlreadyStarted) && sc.task.Concurrency == ConcurrencyAllow {
+			err = s.startExtra(processes[name])
+		}
+		if err != nil && !errors.Is(err, ErrProcessAlreadyStarted) {
+			slog.Error("scheduled run",
+				slog.String("process", name),
+				slog.Any("error", err),
+			)
+		}
+	}
+}
+
+// startExtra starts a run in an extra instance of the task of process, as
+// process can only run one child at a time. The instance is removed once its
+// run is over.
+func (s *Service) startExtra(process *Process) error {
+	s.mu.Lock()
+	var name string
+	for i := 1; ; i++ {
+		name = fmt.Sprintf(extraProcessFormat, process.name, i)
+		if _, exists := s.processes[name]; !exists {
+			break
+		}
+	}
+	extra := s.newProcess(name, process.taskName, process.index, process.task)
+	extra.extra = true
+	s.processes[name] = extra
+	s.mu.Unlock()
+
+	slog.Info("scheduled run overlaps the previous one",
+		slog.String("process", name),
+	)
+	err := extra.send(requestStart)
+	go func() {
+		if err == nil {
+			extra.waitFor(extra.ctx, func(status ProcessStatus, _ HealthStatus) bool {
+				return !status.active()
+			})
+		}
+		s.mu.Lock()
+		if s.processes[name] == extra {
+			delete(s.processes, name)
+		}
+		s.mu.Unlock()
+		extra.retire()
+	}()
+	return err
+}
+
+// lastRun returns the last run of a task saved in stateFile.
+func (s *Service) lastRun(stateFile, taskName string) time.Time {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if stateFile == "" {
+		return time.Time{}
+	}
+	state, err := readScheduleState(stateFile)
+	if err != nil {
+		slog.Error("read state file", slog.Any("error", err))
+	}
+	return state[taskName]
+}
+
+// saveLastRun saves the last run of a task in stateFile.
+func (s *Service) saveLastRun(stateFile, taskName string, at time.Time) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if stateFile == "" {
+		return
+	}
+	state, err := readScheduleState(stateFile)
+	if err != nil {
+		slog.Error("read state file", slog.Any("error", err))
+	}
+	state[taskName] = at
+
+	data, err := json.Marshal(state)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(stateFile), 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(stateFile, data, 0600)
+	}
+	if err != nil {
+		slog.Error("write state file", slog.Any("error", err))
+	}
+}
+
+func readScheduleState(path string) (map[string]time.Time, error) {
+	state := make(map[string]time.Time)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return make(map[string]time.Time), err
+	}
+	return state, nil
+}
+
+// defaultStateFile returns the state file path in the user cache dir.
+func defaultStateFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "taskmaster", "state.json")
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
 )
 
@@ -18,26 +21,50 @@ const (
 	defaultStartTime    = 3 * time.Second
 	defaultStartRetries = 3
 
+	defaultBackoffInitial    = time.Second
+	defaultBackoffMultiplier = 2
+	defaultBackoffMax        = time.Minute
+	defaultBackoffReset      = time.Minute
+	defaultRestartWindow     = 10 * time.Minute
+
 	processNameFormat string = "%s_%02d"
 )
 
 type Service struct {
-	Ctx       context.Context
-	Cancel    context.CancelCauseFunc
-	cfg       *Config
-	out       *os.File
-	mu        sync.Mutex
-	processes map[string]*Process
+	Ctx        context.Context
+	Cancel     context.CancelCauseFunc
+	cfg        *Config
+	mu         sync.Mutex
+	processes  map[string]*Process
+	schedulers map[string]*scheduler
+	stateMu    sync.Mutex
+	history    runHistory
+	notifiers  []io.Closer
+	logLevel   *slog.LevelVar
+	logs       *LogBuffer
+	events     eventBus
+	reloads    reloadStats
+	stats      statsCollector
+	limits     limitWatch
+	outputs    outputFiles
+	listeners  listenerPools
+
+	// The notifiers of the config, made again when they change on reload.
+	cfgNotifiers []io.Closer
 }
 
 func New(cfg *Config, opts ...OptFn) *Service {
 	ctx, cancel := context.WithCancelCause(context.Background())
 	s := &Service{
-		Ctx:    ctx,
-		Cancel: cancel,
-		cfg:    cfg,
+		Ctx:      ctx,
+		Cancel:   cancel,
+		cfg:      cfg,
+		logLevel: new(slog.LevelVar),
 	}
+	s.cfgNotifiers = s.makeNotifiers(cfg.Notifiers)
 	s.processes = s.makeProcesses(cfg.Tasks)
+	s.schedulers = s.makeSchedulers(cfg.Tasks, nil)
+	go s.collectStats()
 
 	for _, fn := range opts {
 		fn(s)
@@ -52,16 +79,7 @@ func (s *Service) makeProcesses(tasks map[string]*Task) map[string]*Process {
 
 	for taskName, task := range tasks {
 		if task.NumProcs == 1 {
-			process, err := s.newProcess(taskName, task)
-			if err != nil {
-				slog.Error("failed to make process",
-					slog.String("process", taskName),
-					slog.Any("error", err),
-				)
-				continue
-			}
-
-			processes[taskName] = process
+			processes[taskName] = s.newProcess(taskName, taskName, 0, task)
 			slog.Info("init",
 				slog.String("process", taskName),
 			)
@@ -69,16 +87,7 @@ func (s *Service) makeProcesses(tasks map[string]*Task) map[string]*Process {
 		}
 		for i := range task.NumProcs {
 			processName := fmt.Sprintf(processNameFormat, taskName, i)
-			process, err := s.newProcess(processName, task)
-			if err != nil {
-				slog.Error("init process failed",
-					slog.String("process", processName),
-					slog.Any("error", err),
-				)
-				continue
-			}
-
-			processes[processName] = process
+			processes[processName] = s.newProcess(processName, taskName, i, task)
 			slog.Info("init",
 				slog.String("process", processName),
 			)
@@ -88,187 +97,89 @@ func (s *Service) makeProcesses(tasks map[string]*Task) map[string]*Process {
 	return processes
 }
 
-// Start starts a process if it exists.
-//
-// Parameters:
-//   - name: the name of the process.
-func (s *Service) Start(name string) error {
+// process returns the process called name.
+func (s *Service) process(name string) (*Process, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	process, exists := s.processes[name]
 	if !exists {
-		return ErrProcessUnknown
+		return nil, ErrProcessUnknown
 	}
 	if process == nil {
-		return ErrProcessNil
-	}
-	if process.cmd.Process != nil {
-		return ErrProcessAlreadyStarted
-	}
-
-	for range process.task.StartRetries {
-		if err := process.Start(); err != nil {
-			return ErrProcessAlreadyStarted
-		}
-		slog.Info("spawned",
-			slog.String("process", name),
-			slog.Int("pid", process.cmd.Process.Pid),
-		)
-		tmpCmd := process.cmd
-		go s.handleProcessCompletion(name)
-
-		// Wait StartTime to see if the process successfully started.
-		time.Sleep(process.task.StartTime)
-		if tmpCmd.ProcessState == nil {
-			slog.Info("success",
-				slog.String("process", name),
-				slog.Int("pid", tmpCmd.Process.Pid),
-				slog.Int("tries", process.startCount),
-			)
-			s.processes[name].status = ProcessStatusRunning
-			return nil
-		}
-		time.Sleep(time.Millisecond * 100)
+		return nil, ErrProcessNil
 	}
-
-	process.status = ProcessStatusFailed
-	return ErrProcessIsNotRunning
+	return process, nil
 }
 
-// handleProcessCompletion handles the completion of a process. Id needed it
-// retry to start it, or restart it.
-func (s *Service) handleProcessCompletion(name string) {
-	process := s.processes[name]
-
-	err := process.cmd.Wait()
-	shouldRetryStart := process.ShouldRetryStart()
-	shouldRestart := process.ShouldRestart()
-	slog.Warn("exited",
-		slog.String("process", name),
-		slog.Int("exit_code", process.cmd.ProcessState.ExitCode()),
-		slog.Bool("should_retry_start", shouldRetryStart),
-		slog.Bool("should_restart", shouldRestart),
-		slog.Int("start_count", process.startCount),
-	)
-
-	if err == nil {
-		// Successful exit.
-		process.done <- nil
-		if err := s.resetProcess(name, ProcessStatusExited); err != nil {
-			slog.Error("failed",
-				slog.String("process", name),
-				slog.Any("resetProcess", err))
-		}
-		return
-	}
-
-	if shouldRetryStart {
-		process.cmd, err = s.newCmd(name, process.task)
-		process.status = ProcessStatusFailed
-		if err != nil {
-			slog.Error("failed",
-				slog.String("process", name),
-				slog.Any("newCmd", err))
-		}
-		return
-	}
-
-	if shouldRestart {
-		if err := s.resetProcess(name, ProcessStatusIdle); err != nil {
-			slog.Error("failed",
-				slog.String("process", name),
-				slog.Any("resetProcess", err))
-			return
-		}
-
-		if err := s.Start(name); err != nil {
-			slog.Error("retry start",
-				slog.String("process", name),
-				slog.Any("service.Start", err))
-		}
-		return
+// Start starts a process if it exists. It returns as soon as the process is
+// spawned, without waiting for it to be successfully started.
+//
+// Parameters:
+//   - name: the name of the process.
+func (s *Service) Start(name string) error {
+	process, err := s.process(name)
+	if err != nil {
+		return err
 	}
 
-	process.done <- err
-	status := ProcessStatusExited
-	if process.status == ProcessStatusStopped {
-		status = ProcessStatusStopped
-	}
-	if err := s.resetProcess(name, status); err != nil {
-		slog.Error("failed",
-			slog.String("process", name),
-			slog.Any("resetProcess", err))
-	}
+	return process.send(requestStart)
 }
 
-func (s *Service) Stop(name string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	process, exits := s.processes[name]
-	if !exits {
-		return ErrProcessUnknown
-	}
-	if process == nil {
-		return ErrProcessNil
+// StartWait starts a process and waits until it is running, or until it
+// failed to start.
+//
+// Parameters:
+//   - name: the name of the process.
+func (s *Service) StartWait(name string) error {
+	process, err := s.process(name)
+	if err != nil {
+		return err
 	}
-	if process.cmd == nil || process.cmd.Process == nil {
-		return ErrProcessIsNotRunning
+	if err := process.send(requestStart); err != nil {
+		return err
 	}
 
-	var sig syscall.Signal
-	switch process.task.StopSignal {
-	case "", "TERM", "SIGTERM":
-		sig = syscall.SIGTERM
-	case "INT", "SIGINT":
-		sig = syscall.SIGINT
-	case "KILL", "SIGKILL":
-		sig = syscall.SIGKILL
-	case "HUP", "SIGHUP":
-		sig = syscall.SIGHUP
-	case "USR1", "SIGUSR1":
-		sig = syscall.SIGUSR1
-	case "USR2", "SIGUSR2":
-		sig = syscall.SIGUSR2
+	switch process.wait(s.Ctx,
+		ProcessStatusRunning,
+		ProcessStatusExited,
+		ProcessStatusStopped,
+		ProcessStatusFatal,
+	) {
+	case ProcessStatusRunning, ProcessStatusExited:
+		return nil
+	case ProcessStatusFatal:
+		return ErrProcessStartFailed
 	default:
-		return fmt.Errorf("unsupported stop signal: %s", process.task.StopSignal)
+		return ErrProcessIsNotRunning
 	}
+}
 
-	process.status = ProcessStatusStopped
-
-	if err := process.cmd.Process.Signal(sig); err != nil {
-		return fmt.Errorf("failed to send signal %s to task %s: %w", sig, name, err)
+// Stop stops a process and waits for it to exit. The process is killed if it
+// doesn't exit after its task StopTime.
+//
+// Parameters:
+//   - name: the name of the process.
+func (s *Service) Stop(name string) error {
+	process, err := s.process(name)
+	if err != nil {
+		return err
 	}
 
-	select {
-	case err := <-process.done:
-		if err != nil {
-			return fmt.Errorf("task %s exited with error: %w", name, err)
-		}
-		return nil
-	case <-time.After(process.task.StopTime):
-		// Timeout reached, force kill
-		if err := process.cmd.Process.Kill(); err != nil {
-			return fmt.Errorf("failed to kill task %s: %w", name, err)
-		}
-		return fmt.Errorf("task %s was forcibly killed after timeout", name)
-	}
+	return process.send(requestStop)
 }
 
 func (s *Service) Status(name string) ProcessStatus {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	process, exists := s.processes[name]
-	if !exists || process == nil {
+	process, err := s.process(name)
+	if err != nil {
 		return ProcessStatusUnknown
 	}
 
-	return process.status
+	return process.Status()
 }
 
-// AutoStart starts processes that is set to auto start.
+// AutoStart starts processes that is set to auto start, and the processes
+// they depend on, in priority and dependency order.
 //
 // Returns:
 //   - wait: A function to wait the completion of AutoStart
@@ -281,6 +192,7 @@ func (s *Service) AutoStart() (wait func()) {
 	go func() {
 		defer close(c)
 		var keys []string
+		s.mu.Lock()
 		for name, process := range s.processes {
 			if process == nil {
 				continue
@@ -291,24 +203,35 @@ func (s *Service) AutoStart() (wait func()) {
 			}
 			keys = append(keys, name)
 		}
-		if err := s.Batch(s.Start, keys); err != nil {
-			slog.Error("auto start", slog.Any("Batch", err))
+		s.mu.Unlock()
+		if err := s.startOrdered(keys); err != nil {
+			slog.Error("auto start", slog.Any("startOrdered", err))
 		}
 	}()
 
 	return
 }
 
-// Close shuts down the service and cleans up resources.
+// Close shuts down the service and cleans up resources. Processes are
+// stopped in descending priority, and before the processes they depend on.
 func (s *Service) Close() error {
 	defer s.Cancel(ServiceClosed)
+	defer s.events.close()
+	defer s.listeners.prune(nil)
+	defer s.closeNotifiers()
 	var keys []string
+	s.mu.Lock()
+	// No run starts while stopping.
+	for _, sc := range s.schedulers {
+		sc.cancel()
+	}
 	for name, process := range s.processes {
-		if process.status == ProcessStatusRunning {
+		if process.Status().active() {
 			keys = append(keys, name)
 		}
 	}
-	if err := s.Batch(s.Stop, keys); err != nil {
+	s.mu.Unlock()
+	if err := s.stopOrdered(keys); err != nil {
 		return fmt.Errorf("close errors: %w", err)
 	}
 
@@ -316,8 +239,24 @@ func (s *Service) Close() error {
 	return nil
 }
 
-func (s *Service) newCmd(name string, task *Task) (*exec.Cmd, error) {
-	cmd := exec.CommandContext(s.Ctx, task.Cmd, task.Args...)
+// closeNotifiers drains the notifiers, so the last records are delivered.
+func (s *Service) closeNotifiers() {
+	s.mu.Lock()
+	notifiers := append(slices.Clone(s.cfgNotifiers), s.notifiers...)
+	s.mu.Unlock()
+	closeNotifiers(notifiers)
+}
+
+func closeNotifiers(notifiers []io.Closer) {
+	for _, n := range notifiers {
+		if err := n.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to close notifier: %v\n", err)
+		}
+	}
+}
+
+func (s *Service) newCmd(ctx context.Context, name string, task *Task) (*exec.Cmd, error) {
+	cmd := exec.CommandContext(ctx, task.Cmd, task.Args...)
 	cmd.Args[0] = name
 
 	if task.WorkingDir != "" {
@@ -332,78 +271,73 @@ func (s *Service) newCmd(name string, task *Task) (*exec.Cmd, error) {
 		cmd.Env = env
 	}
 
-	if task.Stdout == "" {
-		cmd.Stdout = nil
-	} else {
-		file, err := os.OpenFile(task.Stdout, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open stdout file %s: %w", task.Stdout, err)
-		}
-		cmd.Stdout = file
+	return cmd, nil
+}
+
+// newProcess makes a process and starts its supervisor goroutine.
+func (s *Service) newProcess(name, taskName string, index int, task *Task) *Process {
+	var listener *eventListener
+	if task.Type == TaskTypeEventListener {
+		listener = s.listeners.listener(taskName, task, s.events.subscribe)
 	}
+	return newProcess(s.Ctx, name, taskName, index, task, func(ctx context.Context) (*exec.Cmd, error) {
+		return s.newCmd(ctx, name, task)
+	}, s.history.add, s.events.publish, listener, &s.outputs)
+}
 
-	if task.Stderr == "" {
-		cmd.Stderr = nil
-	} else {
-		file, err := os.OpenFile(task.Stderr, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open stderr file %s: %w", task.Stderr, err)
-		}
-		cmd.Stderr = file
+func (s *Service) GetPid(name string) (int, error) {
+	process, err := s.process(name)
+	if err != nil {
+		return 0, err
 	}
 
-	return cmd, nil
+	return process.Pid()
 }
 
-func (s *Service) newProcess(name string, task *Task) (*Process, error) {
-	cmd, err := s.newCmd(name, task)
+// Info returns a snapshot of the state of a process.
+func (s *Service) Info(name string) (ProcessInfo, error) {
+	process, err := s.process(name)
 	if err != nil {
-		return nil, fmt.Errorf("s.newCmd: %w", err)
-	}
-	return &Process{
-		cmd:        cmd,
-		task:       task,
-		startCount: 0,
-		startAt:    time.Time{},
-		status:     ProcessStatusIdle,
-		done:       make(chan error, 1),
-	}, nil
+		return ProcessInfo{}, err
+	}
+
+	return s.info(process), nil
 }
 
-func (s *Service) resetProcess(name string, status ProcessStatus) (err error) {
+// InfoAll returns a snapshot of the state of every process, sorted by name.
+func (s *Service) InfoAll() []ProcessInfo {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	process, exists := s.processes[name]
-	if !exists {
-		return ErrProcessUnknown
+	processes := make([]*Process, 0, len(s.processes))
+	for _, process := range s.processes {
+		processes = append(processes, process)
 	}
+	s.mu.Unlock()
 
-	s.processes[name], err = s.newProcess(name, process.task)
-	if err != nil {
-		return err
+	infos := make([]ProcessInfo, 0, len(processes))
+	for _, process := range processes {
+		infos = append(infos, s.info(process))
 	}
-	s.processes[name].status = status
-
-	return
+	slices.SortFunc(infos, func(a, b ProcessInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return infos
 }
 
-func (s *Service) GetPid(name string) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// info completes the snapshot of a process with what the service knows of
+// its task.
+func (s *Service) info(process *Process) ProcessInfo {
+	info := process.Info()
 
-	process, exists := s.processes[name]
-	if !exists {
-		return 0, ErrProcessUnknown
-	}
-	if process == nil {
-		return 0, ErrProcessNil
-	}
-	if process.cmd == nil || process.cmd.Process == nil || process.cmd.ProcessState != nil {
-		return 0, ErrProcessIsNotRunning
+	s.mu.Lock()
+	sc, scheduled := s.schedulers[process.taskName]
+	s.mu.Unlock()
+	if scheduled {
+		info.NextRun = sc.nextRun()
+		info.LastRun = sc.lastRun()
+		info.Description = info.describe()
 	}
-
-	return process.cmd.Process.Pid, nil
+	info.Stats = s.stats.last(process.name, info.Pid)
+	return info
 }
 
 func (s *Service) List() []string {
@@ -451,22 +385,36 @@ func (s *Service) Batch(fn func(name string) error, names []string) error {
 }
 
 func (s *Service) Reload() (changed bool, err error) {
-	s.mu.Lock()
+	defer func() {
+		s.reloads.record(err)
+		if changed || err != nil {
+			s.emitReload(err)
+		}
+	}()
+
 	var newCfg Config
 	if err := newCfg.Load(); err != nil {
 		return false, fmt.Errorf("service: failed to load config: %w", err)
 	}
+	s.mu.Lock()
 	if newCfg.Compare(*s.cfg) {
 		s.mu.Unlock()
 		return false, nil
 	}
 
 	newProcesses := s.makeProcesses(newCfg.Tasks)
+	// The extra runs of a scheduled task go on if it doesn't need a restart.
+	for name, process := range s.processes {
+		task, exists := newCfg.Tasks[process.taskName]
+		if process.extra && exists && !process.task.DiffNeedRestart(*task) {
+			newProcesses[name] = process
+		}
+	}
 
 	// Stop all processes not in the new processes
 	var keys []string
 	for _, name := range diffProcesses(s.processes, newProcesses) {
-		if s.processes[name].status == ProcessStatusRunning {
+		if s.processes[name].Status().active() {
 			keys = append(keys, name)
 		}
 	}
@@ -474,7 +422,7 @@ func (s *Service) Reload() (changed bool, err error) {
 		slog.Any("names", keys),
 	)
 	s.mu.Unlock()
-	if err := s.Batch(s.Stop, keys); err != nil {
+	if err := s.stopOrdered(keys); err != nil {
 		return false, fmt.Errorf("error while stopping old processes: %w", err)
 	}
 	s.mu.Lock()
@@ -485,30 +433,42 @@ func (s *Service) Reload() (changed bool, err error) {
 	for _, name := range commonProcesses(newProcesses, s.processes) {
 		slog.Debug("commonProcesses",
 			slog.String("process", name),
-			slog.String("status", s.processes[name].status.String()),
+			slog.String("status", s.processes[name].Status().String()),
 			slog.Bool("DiffNeedRestart", s.processes[name].task.DiffNeedRestart(*newProcesses[name].task)),
 			slog.Int("old_task_proces", s.processes[name].task.NumProcs),
 			slog.String("old_task_proces", s.processes[name].task.Stdout),
 			slog.Int("new_task_proces", newProcesses[name].task.NumProcs),
 			slog.String("new_task_proces", newProcesses[name].task.Stdout),
 		)
-		if s.processes[name].status != ProcessStatusRunning {
+		if !s.processes[name].Status().active() || newProcesses[name] == s.processes[name] {
 			continue
 		}
 		if s.processes[name].task.DiffNeedRestart(*newProcesses[name].task) {
 			keys = append(keys, name)
 		} else {
+			newProcesses[name].retire()
 			newProcesses[name] = s.processes[name]
 		}
 	}
+	s.mu.Unlock()
+	keys = s.withDependents(keys)
+	// Extra runs aren't restarted with their dependencies, they finish.
+	keys = slices.DeleteFunc(keys, func(name string) bool {
+		process, exists := newProcesses[name]
+		return exists && process.extra
+	})
+	for _, name := range keys {
+		if newProcess, exists := newProcesses[name]; exists && newProcess == s.processes[name] {
+			// Kept as is above, but restarted with a dependency.
+			newProcesses[name] = s.newProcess(name, newProcess.taskName, newProcess.index, newCfg.Tasks[newProcess.taskName])
+		}
+	}
 	slog.Debug("batch stop for restart",
 		slog.Any("names", keys),
 	)
-	s.mu.Unlock()
-	if err := s.Batch(s.Stop, keys); err != nil {
+	if err := s.stopOrdered(keys); err != nil {
 		return false, fmt.Errorf("error while stopping for restart processes: %w", err)
 	}
-	time.Sleep(time.Millisecond * 500)
 	s.mu.Lock()
 
 	slog.Debug("processes switch",
@@ -517,13 +477,31 @@ func (s *Service) Reload() (changed bool, err error) {
 	)
 	oldProcesses := s.processes
 	s.processes = newProcesses
+	var oldNotifiers []io.Closer
+	if !reflect.DeepEqual(s.cfg.Notifiers, newCfg.Notifiers) {
+		oldNotifiers = s.cfgNotifiers
+		s.cfgNotifiers = s.makeNotifiers(newCfg.Notifiers)
+	}
 	*s.cfg = newCfg
+	for _, sc := range s.schedulers {
+		sc.cancel()
+	}
+	s.schedulers = s.makeSchedulers(newCfg.Tasks, s.schedulers)
+	s.outputs.prune(newCfg.Tasks)
+	s.listeners.prune(newCfg.Tasks)
+	for name, process := range oldProcesses {
+		if newProcesses[name] != process {
+			process.retire()
+		}
+	}
 
 	slog.Debug("batch start for restart",
 		slog.Any("names", keys),
 	)
 	s.mu.Unlock()
-	if err := s.Batch(s.Start, keys); err != nil {
+	// The replaced notifiers deliver their pending events meanwhile.
+	go closeNotifiers(oldNotifiers)
+	if err := s.startOrdered(keys); err != nil {
 		return true, fmt.Errorf("error while restarting processes: %w", err)
 	}
 	s.mu.Lock()
@@ -539,7 +517,7 @@ func (s *Service) Reload() (changed bool, err error) {
 		slog.Any("names", keys),
 	)
 	s.mu.Unlock()
-	if err := s.Batch(s.Start, keys); err != nil {
+	if err := s.startOrdered(keys); err != nil {
 		return false, fmt.Errorf("error while starting new processes: %w", err)
 	}
 
@@ -576,8 +554,23 @@ func commonProcesses(a, b map[string]*Process) []string {
 // =============================
 type OptFn func(*Service)
 
-func WithOutputFile(f *os.File) OptFn {
+// WithLogLevel lets the service change the level of the logs.
+func WithLogLevel(level *slog.LevelVar) OptFn {
+	return func(s *Service) {
+		s.logLevel = level
+	}
+}
+
+// WithLogBuffer lets the service return its last logs.
+func WithLogBuffer(logs *LogBuffer) OptFn {
+	return func(s *Service) {
+		s.logs = logs
+	}
+}
+
+// WithNotifier closes n when the service is closed.
+func WithNotifier(n io.Closer) OptFn {
 	return func(s *Service) {
-		s.out = f
+		s.notifiers = append(s.notifiers, n)
 	}
 }
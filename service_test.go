@@ -1,6 +1,8 @@
 package taskmaster
 
 import (
+	"context"
+	"fmt"
 	"testing"
 	"time"
 )
@@ -51,13 +53,260 @@ func TestService_Start_v2(t *testing.T) {
 	}
 	s := New(cfg)
 
-	err := s.Start("supertail")
+	err := s.StartWait("supertail")
 	if err == nil {
 		t.Error("Expected Start to have error")
 	}
 
-	err = <-s.processes["supertail"].done
-	if err == nil {
-		t.Error("Expected process having error")
+	if status := s.Status("supertail"); status != ProcessStatusFatal {
+		t.Errorf("Expected process to be Fatal, got %s", status)
+	}
+}
+
+func TestService_StartDoesNotBlock(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"sleeper": {
+				Cmd:          "sleep",
+				Args:         []string{"10"},
+				NumProcs:     1,
+				StartRetries: 3,
+				StartTime:    time.Millisecond * 500,
+				StopTime:     time.Second * 3,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	st := time.Now()
+	if err := s.Start("sleeper"); err != nil {
+		t.Fatalf("Expected Start to succeed, got %v", err)
+	}
+	if status := s.Status("sleeper"); status != ProcessStatusStarting {
+		t.Errorf("Expected process to be Starting, got %s", status)
+	}
+	if time.Since(st) > cfg.Tasks["sleeper"].StartTime {
+		t.Error("Expected Start to return before StartTime")
+	}
+
+	if err := s.StartWait("sleeper"); err != ErrProcessAlreadyStarted {
+		t.Errorf("Expected ErrProcessAlreadyStarted, got %v", err)
+	}
+	s.processes["sleeper"].wait(s.Ctx, ProcessStatusRunning)
+
+	if _, err := s.GetPid("sleeper"); err != nil {
+		t.Errorf("Expected a pid, got %v", err)
+	}
+	if err := s.Stop("sleeper"); err != nil {
+		t.Errorf("Expected Stop to succeed, got %v", err)
+	}
+	if status := s.Status("sleeper"); status != ProcessStatusStopped {
+		t.Errorf("Expected process to be Stopped, got %s", status)
+	}
+}
+
+func TestService_InfoAll(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"sleeper": {
+				Cmd:      "sleep",
+				Args:     []string{"10"},
+				NumProcs: 2,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	infos := s.InfoAll()
+	if len(infos) != 2 {
+		t.Fatalf("Expected 2 infos, got %d", len(infos))
+	}
+	for i, info := range infos {
+		if info.Name != fmt.Sprintf(processNameFormat, "sleeper", i) {
+			t.Errorf("Expected infos sorted by name, got %s at %d", info.Name, i)
+		}
+		if info.Task != "sleeper" || info.Index != i {
+			t.Errorf("Expected task sleeper index %d, got %s %d", i, info.Task, info.Index)
+		}
+		if info.State != ProcessStatusIdle || info.Pid != 0 {
+			t.Errorf("Expected idle process without pid, got %s %d", info.State, info.Pid)
+		}
+	}
+
+	if _, err := s.Info("nope"); err != ErrProcessUnknown {
+		t.Errorf("Expected ErrProcessUnknown, got %v", err)
+	}
+}
+
+func TestService_CrashLoopGoesFatal(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"crasher": {
+				Cmd:          "sh",
+				Args:         []string{"-c", "sleep 0.05; exit 1"},
+				NumProcs:     1,
+				AutoRestart:  AutoRestartAlways,
+				StartRetries: 3,
+				StartTime:    time.Millisecond * 10,
+				StopTime:     time.Second,
+				Backoff: Backoff{
+					Initial:    time.Millisecond * 10,
+					Multiplier: 2,
+					Max:        time.Millisecond * 50,
+					Reset:      time.Minute,
+				},
+				MaxRestarts:   2,
+				RestartWindow: time.Minute,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if err := s.StartWait("crasher"); err != nil {
+		t.Fatalf("Expected StartWait to succeed, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(s.Ctx, 5*time.Second)
+	defer cancel()
+	if status := s.processes["crasher"].wait(ctx, ProcessStatusFatal); status != ProcessStatusFatal {
+		t.Fatalf("Expected process to be Fatal, got %s", status)
+	}
+	if info, _ := s.Info("crasher"); info.StartCount != 3 {
+		t.Errorf("Expected 3 spawns, got %d", info.StartCount)
+	}
+}
+
+func TestService_PriorityOrder(t *testing.T) {
+	task := func(priority int) *Task {
+		return &Task{
+			Cmd:          "sleep",
+			Args:         []string{"10"},
+			NumProcs:     2,
+			AutoStart:    true,
+			StartRetries: 1,
+			StartTime:    time.Millisecond * 100,
+			StopTime:     time.Second,
+			Priority:     priority,
+		}
+	}
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"first":  task(1),
+			"second": task(2),
+		},
+	}
+	s := New(cfg)
+	defer s.Cancel(nil)
+
+	s.AutoStart()()
+
+	first, _ := s.Info("first_00")
+	second, _ := s.Info("second_01")
+	if second.StartTime.Before(first.StartTime.Add(cfg.Tasks["first"].StartTime)) {
+		t.Error("Expected second tier to start after first tier was running")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Expected Close to succeed, got %v", err)
+	}
+	first, _ = s.Info("first_01")
+	second, _ = s.Info("second_00")
+	if first.ExitTime.Before(second.ExitTime) {
+		t.Error("Expected second tier to stop before first tier")
+	}
+}
+
+func TestService_Schedule(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"job": {
+				Cmd:          "sleep",
+				Args:         []string{"10"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    time.Second,
+				StopTime:     time.Second,
+				Schedule:     "@every 1s",
+				Concurrency:  ConcurrencyForbid,
+				MaxRuntime:   time.Millisecond * 500,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	info, _ := s.Info("job")
+	if info.NextRun.IsZero() {
+		t.Fatal("Expected a next run")
+	}
+
+	ctx, cancel := context.WithTimeout(s.Ctx, 5*time.Second)
+	defer cancel()
+	process := s.processes["job"]
+	if status := process.wait(ctx, ProcessStatusRunning); status != ProcessStatusRunning {
+		t.Fatalf("Expected the scheduled run to be Running right away, got %s", status)
+	}
+	if status := process.wait(ctx, ProcessStatusStopped); status != ProcessStatusStopped {
+		t.Fatalf("Expected the run to be stopped after its max runtime, got %s", status)
+	}
+
+	info, _ = s.Info("job")
+	if info.LastRun.IsZero() || !info.NextRun.After(info.LastRun) {
+		t.Errorf("Expected last run before next run, got %s and %s", info.LastRun, info.NextRun)
+	}
+}
+
+func TestService_ScheduleAllow(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"job": {
+				Cmd:          "sleep",
+				Args:         []string{"1.5"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    time.Second,
+				StopTime:     time.Second,
+				Schedule:     "@every 1s",
+				Concurrency:  ConcurrencyAllow,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	// The second run starts while the first one is still running.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := s.Info("job.run1")
+		if err == nil && info.Pid != 0 {
+			if pid, _ := s.GetPid("job"); pid == 0 || pid == info.Pid {
+				t.Fatalf("Expected both runs to be alive, got pids %d and %d", pid, info.Pid)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected an extra instance for the overlapping run")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// And it is removed once done.
+	s.mu.Lock()
+	extra := s.processes["job.run1"]
+	s.mu.Unlock()
+	for {
+		s.mu.Lock()
+		current := s.processes["job.run1"]
+		s.mu.Unlock()
+		if current != extra {
+			break
+		}
+		if time.Now().After(deadline.Add(5 * time.Second)) {
+			t.Fatal("Expected the extra instance to be removed after its run")
+		}
+		time.Sleep(20 * time.Millisecond)
 	}
 }
@@ -0,0 +1,379 @@
+package taskmaster
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// statsInterval is how often the running processes are sampled.
+	statsInterval = 2 * time.Second
+
+	// statsHistorySize is how many samples are kept for each process.
+	statsHistorySize = 60
+
+	procDir = "/proc"
+
+	// clockTicks is USER_HZ, the unit of the CPU times in /proc, which is
+	// 100 on all the Linux platforms.
+	clockTicks = 100
+)
+
+// ProcessStats is a sample of the resources used by the child of a process,
+// and by its descendants if its task asks for it.
+type ProcessStats struct {
+	Time time.Time
+	Pid  int
+
+	// How many processes were sampled.
+	Procs int
+
+	// The CPU used since the previous sample, 100 being a whole CPU.
+	CPU float64
+
+	// The resident memory, in bytes.
+	RSS     uint64
+	Threads int
+	FDs     int
+
+	// The bytes read and written to storage since the start.
+	ReadBytes  uint64
+	WriteBytes uint64
+}
+
+// statsCollector keeps the last samples of each process.
+type statsCollector struct {
+	mu      sync.Mutex
+	samples map[string][]ProcessStats
+	cpu     map[string]cpuTime
+}
+
+// cpuTime is the CPU time of a child at some point, to compute its usage
+// until the next sample.
+type cpuTime struct {
+	pid   int
+	ticks uint64
+	at    time.Time
+}
+
+// add records a sample of process name, ticks being its CPU time and start
+// when its child started. It returns the sample with its CPU usage.
+func (c *statsCollector) add(name string, st ProcessStats, ticks uint64, start time.Time) ProcessStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.samples == nil {
+		c.samples = make(map[string][]ProcessStats)
+		c.cpu = make(map[string]cpuTime)
+	}
+
+	// The first sample of a child averages its usage since its start.
+	used, since := ticks, start
+	if prev, exists := c.cpu[name]; exists && prev.pid == st.Pid {
+		used, since = 0, prev.at
+		if ticks > prev.ticks {
+			used = ticks - prev.ticks
+		}
+	}
+	if elapsed := st.Time.Sub(since).Seconds(); elapsed > 0 {
+		st.CPU = float64(used) / clockTicks / elapsed * 100
+	}
+	c.cpu[name] = cpuTime{pid: st.Pid, ticks: ticks, at: st.Time}
+
+	samples := c.samples[name]
+	if len(samples) == statsHistorySize {
+		samples = samples[1:]
+	}
+	c.samples[name] = append(samples, st)
+	return st
+}
+
+// history returns the samples of process name, oldest first.
+func (c *statsCollector) history(name string) []ProcessStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ProcessStats(nil), c.samples[name]...)
+}
+
+// last returns the last sample of process name if it is one of its child
+// pid.
+func (c *statsCollector) last(name string, pid int) *ProcessStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	samples := c.samples[name]
+	if pid == 0 || len(samples) == 0 || samples[len(samples)-1].Pid != pid {
+		return nil
+	}
+	st := samples[len(samples)-1]
+	return &st
+}
+
+// prune forgets the processes which are gone.
+func (c *statsCollector) prune(processes map[string]*Process) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name := range c.samples {
+		if _, exists := processes[name]; !exists {
+			delete(c.samples, name)
+			delete(c.cpu, name)
+		}
+	}
+}
+
+// collectStats samples the running processes until the service is closed.
+func (s *Service) collectStats() {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.Ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.sampleStats(now)
+		}
+	}
+}
+
+func (s *Service) sampleStats(now time.Time) {
+	s.mu.Lock()
+	processes := maps.Clone(s.processes)
+	// The stats and limits settings of the tasks apply without a restart,
+	// they are read from the current config rather than from the processes.
+	tasks := s.cfg.Tasks
+	s.mu.Unlock()
+
+	var children map[int][]int
+	for name, process := range processes {
+		task, exists := tasks[process.taskName]
+		info := process.Info()
+		if !exists || info.Pid == 0 {
+			continue
+		}
+
+		pids := []int{info.Pid}
+		if task.StatsTree {
+			if children == nil {
+				children = procChildren()
+			}
+			pids = descendants(info.Pid, children)
+		}
+		st, ticks, err := sampleProcs(pids)
+		if err != nil {
+			// The child exited meanwhile.
+			continue
+		}
+		st.Time = now
+		st.Pid = info.Pid
+		st = s.stats.add(name, st, ticks, info.StartTime)
+		s.checkLimits(process, task, st)
+	}
+	s.stats.prune(processes)
+	s.limits.prune(processes)
+}
+
+// Stats returns the last samples of the resources used by a process, oldest
+// first.
+//
+// Parameters:
+//   - name: The name of the process.
+//
+// Returns:
+//   - The samples, and an error if the process doesn't exist.
+func (s *Service) Stats(name string) ([]ProcessStats, error) {
+	if _, err := s.process(name); err != nil {
+		return nil, err
+	}
+	return s.stats.history(name), nil
+}
+
+// sampleProcs sums the resources used by pids, and returns their CPU time in
+// clock ticks. It fails if the first pid can't be read.
+func sampleProcs(pids []int) (ProcessStats, uint64, error) {
+	var st ProcessStats
+	var ticks uint64
+	for i, pid := range pids {
+		stat, err := readProcStat(pid)
+		if err == nil {
+			err = readProcStatus(pid, &st)
+		}
+		if err != nil {
+			if i == 0 {
+				return st, 0, err
+			}
+			continue
+		}
+		// io and fd are only readable by the owner of the process.
+		readProcIO(pid, &st)
+		if fds, err := os.ReadDir(filepath.Join(procDir, strconv.Itoa(pid), "fd")); err == nil {
+			st.FDs += len(fds)
+		}
+		ticks += stat.ticks
+		st.Procs++
+	}
+	return st, ticks, nil
+}
+
+// procStat holds the fields of /proc/<pid>/stat in use.
+type procStat struct {
+	ppid  int
+	ticks uint64
+}
+
+func readProcStat(pid int) (procStat, error) {
+	data, err := os.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+	return parseProcStat(data)
+}
+
+// parseProcStat parses /proc/<pid>/stat, whose second field, the command
+// name, is in parentheses and may hold spaces.
+func parseProcStat(data []byte) (procStat, error) {
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return procStat{}, errors.New("stats: invalid stat")
+	}
+	// The fields from the third one, the state.
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 13 {
+		return procStat{}, errors.New("stats: invalid stat")
+	}
+
+	var st procStat
+	var err error
+	if st.ppid, err = strconv.Atoi(fields[1]); err != nil {
+		return procStat{}, fmt.Errorf("stats: invalid ppid: %w", err)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return procStat{}, fmt.Errorf("stats: invalid utime: %w", err)
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return procStat{}, fmt.Errorf("stats: invalid stime: %w", err)
+	}
+	st.ticks = utime + stime
+	return st, nil
+}
+
+// readProcStatus adds the memory and the threads of pid to st.
+func readProcStatus(pid int, st *ProcessStats) error {
+	f, err := os.Open(filepath.Join(procDir, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch key {
+		case "VmRSS":
+			kb, _ := strconv.ParseUint(fields[0], 10, 64)
+			st.RSS += kb * 1024
+		case "Threads":
+			threads, _ := strconv.Atoi(fields[0])
+			st.Threads += threads
+		}
+	}
+	return scanner.Err()
+}
+
+// readProcIO adds the storage IO of pid to st.
+func readProcIO(pid int, st *ProcessStats) error {
+	data, err := os.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "io"))
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, found := strings.Cut(line, ": ")
+		if !found {
+			continue
+		}
+		n, _ := strconv.ParseUint(value, 10, 64)
+		switch key {
+		case "read_bytes":
+			st.ReadBytes += n
+		case "write_bytes":
+			st.WriteBytes += n
+		}
+	}
+	return nil
+}
+
+// procChildren returns the children of every process.
+func procChildren() map[int][]int {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return nil
+	}
+
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if stat, err := readProcStat(pid); err == nil {
+			children[stat.ppid] = append(children[stat.ppid], pid)
+		}
+	}
+	return children
+}
+
+// descendants returns pid followed by all its descendants.
+func descendants(pid int, children map[int][]int) []int {
+	pids := []int{pid}
+	for i := 0; i < len(pids); i++ {
+		pids = append(pids, children[pids[i]]...)
+	}
+	return pids
+}
+
+// WriteStatsTable writes the last stats of infos as a table to w.
+func WriteStatsTable(w io.Writer, infos []ProcessInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATE\tPID\tCPU%\tRSS\tTHREADS\tFDS\tREAD\tWRITE\tUPTIME")
+	for _, info := range infos {
+		if info.Stats == nil {
+			fmt.Fprintf(tw, "%s\t%s\t-\t-\t-\t-\t-\t-\t-\t-\n", info.Name, info.State)
+			continue
+		}
+		st := info.Stats
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			info.Name,
+			info.State,
+			info.Pid,
+			st.CPU,
+			ByteSize(st.RSS),
+			st.Threads,
+			st.FDs,
+			ByteSize(st.ReadBytes),
+			ByteSize(st.WriteBytes),
+			info.Uptime,
+		)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,83 @@
+package taskmaster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseProcStat(t *testing.T) {
+	data := []byte("4242 (my (odd) cmd) S 1 4242 4242 0 -1 4194560 120 0 0 0 25 17 0 0 20 0 3 0 12345 1000 10 1")
+	st, err := parseProcStat(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.ppid != 1 || st.ticks != 42 {
+		t.Errorf("Expected ppid 1 and 42 ticks, got %+v", st)
+	}
+
+	if _, err := parseProcStat([]byte("4242 (cmd")); err == nil {
+		t.Error("Expected an error for a truncated stat")
+	}
+}
+
+func TestService_Stats(t *testing.T) {
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"tree": {
+				Cmd:          "sh",
+				Args:         []string{"-c", "sleep 10 & sleep 10 & wait"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    50 * time.Millisecond,
+				StopTime:     time.Second,
+				StatsTree:    true,
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if err := s.StartWait("tree"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	s.sampleStats(time.Now())
+	s.sampleStats(time.Now())
+
+	stats, err := s.Stats("tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 samples, got %d", len(stats))
+	}
+	st := stats[1]
+	if st.Procs != 3 || st.RSS == 0 || st.Threads < 3 || st.FDs == 0 {
+		t.Errorf("Expected the stats of sh and its 2 children, got %+v", st)
+	}
+
+	info, err := s.Info("tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Stats == nil || *info.Stats != st {
+		t.Errorf("Expected the last sample in the info, got %+v", info.Stats)
+	}
+
+	if _, err := s.Stats("unknown"); err == nil {
+		t.Error("Expected an error for an unknown process")
+	}
+}
+
+func TestByteSize_String(t *testing.T) {
+	for size, want := range map[ByteSize]string{
+		512:      "512B",
+		1536:     "1.5KB",
+		10 << 20: "10.0MB",
+		3 << 30:  "3.0GB",
+	} {
+		if got := size.String(); got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package taskmaster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// The special values of Task.Stdout and Task.Stderr.
+	OutputTargetSyslog   = "syslog"
+	OutputTargetJournald = "journald"
+
+	defaultSyslogAddress   = "/dev/log"
+	defaultJournalAddress  = "/run/systemd/journal/socket"
+	defaultSyslogFacility  = "user"
+	syslogTimestampFormat  = "2006-01-02T15:04:05.000000Z07:00"
+	syslogSeverityInfo     = 6
+	syslogSeverityError    = 3
+	syslogNilValue         = "-"
+	syslogMaxMessageLength = 8192
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogConfig configures the syslog and journald outputs of a program.
+type SyslogConfig struct {
+
+	// Where to send the lines: a unix datagram socket path, or
+	// udp://host:port for syslog.
+	// Default: /dev/log for syslog, /run/systemd/journal/socket for journald.
+	Address string `yaml:"address"`
+
+	// The syslog facility: kern, user, daemon, local0 to local7...
+	// Default: user.
+	Facility string `yaml:"facility"`
+
+	// The identifier of the program.
+	// Default: the task name.
+	Tag string `yaml:"tag"`
+}
+
+// check verifies the syslog settings of task name.
+func (c SyslogConfig) check(name string) error {
+	if c.Facility != "" {
+		if _, exists := syslogFacilities[c.Facility]; !exists {
+			return fmt.Errorf("config: task %s: unknown syslog facility: %s", name, c.Facility)
+		}
+	}
+	if network, _ := c.network(""); network == "" {
+		return fmt.Errorf("config: task %s: invalid syslog address: %s", name, c.Address)
+	}
+	return nil
+}
+
+// network returns the network and the address to dial, def being the
+// default address.
+func (c SyslogConfig) network(def string) (string, string) {
+	address := c.Address
+	if address == "" {
+		address = def
+	}
+	if hostPort, found := strings.CutPrefix(address, "udp://"); found {
+		return "udp", hostPort
+	}
+	if path, found := strings.CutPrefix(address, "unix://"); found {
+		return "unixgram", path
+	}
+	if address == "" || strings.HasPrefix(address, "/") {
+		return "unixgram", address
+	}
+	return "", ""
+}
+
+func (c SyslogConfig) facility() int {
+	if facility, exists := syslogFacilities[c.Facility]; exists {
+		return facility
+	}
+	return syslogFacilities[defaultSyslogFacility]
+}
+
+// syslogWriter sends each line written to it as an RFC 5424 message.
+type syslogWriter struct {
+	conn     net.Conn
+	priority int
+	hostname string
+	tag      string
+	msgID    string
+	pid      func() int
+}
+
+func (w *syslogWriter) Write(line []byte) (int, error) {
+	pid := syslogNilValue
+	if n := w.pid(); n != 0 {
+		pid = strconv.Itoa(n)
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %s %s %s %s",
+		w.priority,
+		time.Now().Format(syslogTimestampFormat),
+		w.hostname,
+		w.tag,
+		pid,
+		w.msgID,
+		syslogNilValue,
+		bytes.TrimRight(line, "\n"),
+	)
+	if len(msg) > syslogMaxMessageLength {
+		msg = msg[:syslogMaxMessageLength]
+	}
+	if _, err := w.conn.Write([]byte(msg)); err != nil {
+		return 0, err
+	}
+	return len(line), nil
+}
+
+func (w *syslogWriter) Close() error {
+	return w.conn.Close()
+}
+
+// journalWriter sends each line written to it as a journal entry, with the
+// native protocol of journald.
+type journalWriter struct {
+	conn   net.Conn
+	fields map[string]string
+	pid    func() int
+}
+
+func (w *journalWriter) Write(line []byte) (int, error) {
+	var entry bytes.Buffer
+	writeJournalField(&entry, "MESSAGE", string(bytes.TrimRight(line, "\n")))
+	for key, value := range w.fields {
+		writeJournalField(&entry, key, value)
+	}
+	if pid := w.pid(); pid != 0 {
+		writeJournalField(&entry, "SYSLOG_PID", strconv.Itoa(pid))
+	}
+
+	if _, err := w.conn.Write(entry.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(line), nil
+}
+
+func (w *journalWriter) Close() error {
+	return w.conn.Close()
+}
+
+// writeJournalField encodes a field of a journal entry. A value holding a
+// new line is written with its length instead of a separator.
+func writeJournalField(w io.Writer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(w, "%s=%s\n", key, value)
+		return
+	}
+	fmt.Fprintf(w, "%s\n", key)
+	binary.Write(w, binary.LittleEndian, uint64(len(value)))
+	fmt.Fprintf(w, "%s\n", value)
+}
+
+// dialOutput connects to the syslog or journald target of a stream of the
+// process. Lines are decorated as for a file.
+func (p *Process) dialOutput(target, stream string) (io.Writer, error) {
+	cfg := p.task.Syslog
+	tag := cfg.Tag
+	if tag == "" {
+		tag = p.taskName
+	}
+	severity := syslogSeverityInfo
+	if stream == OutputStderr {
+		severity = syslogSeverityError
+	}
+	pid := func() int {
+		pid, _ := p.Pid()
+		return pid
+	}
+
+	def := defaultSyslogAddress
+	if target == OutputTargetJournald {
+		def = defaultJournalAddress
+	}
+	network, address := cfg.network(def)
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", target, err)
+	}
+
+	var w io.Writer
+	switch target {
+	case OutputTargetSyslog:
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = syslogNilValue
+		}
+		w = &syslogWriter{
+			conn:     conn,
+			priority: cfg.facility()*8 + severity,
+			hostname: hostname,
+			tag:      tag,
+			msgID:    stream,
+			pid:      pid,
+		}
+	default:
+		w = &journalWriter{
+			conn: conn,
+			fields: map[string]string{
+				"PRIORITY":           strconv.Itoa(severity),
+				"SYSLOG_IDENTIFIER":  tag,
+				"SYSLOG_FACILITY":    strconv.Itoa(cfg.facility()),
+				"TASKMASTER_PROCESS": p.name,
+				"TASKMASTER_TASK":    p.taskName,
+				"TASKMASTER_STREAM":  stream,
+			},
+			pid: pid,
+		}
+	}
+	return &lineWriter{w: w, prefix: p.linePrefix(stream)}, nil
+}
+
+// isOutputTarget returns true if output is syslog or journald rather than a
+// file path.
+func isOutputTarget(output string) bool {
+	return output == OutputTargetSyslog || output == OutputTargetJournald
+}
@@ -0,0 +1,137 @@
+package taskmaster
+
+import (
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenDatagrams returns a unix datagram socket and a function reading the
+// next datagram sent to it.
+func listenDatagrams(t *testing.T) (string, func() string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return path, func() string {
+		buf := make([]byte, 4096)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Expected a datagram, got %v", err)
+		}
+		return string(buf[:n])
+	}
+}
+
+func TestSyslogConfigCheck(t *testing.T) {
+	tests := []struct {
+		cfg     SyslogConfig
+		wantErr bool
+	}{
+		{SyslogConfig{}, false},
+		{SyslogConfig{Address: "/dev/log", Facility: "local3"}, false},
+		{SyslogConfig{Address: "udp://127.0.0.1:514"}, false},
+		{SyslogConfig{Address: "localhost:514"}, true},
+		{SyslogConfig{Facility: "nope"}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.check("test"); (err != nil) != tt.wantErr {
+			t.Errorf("%+v: expected error %v, got %v", tt.cfg, tt.wantErr, err)
+		}
+	}
+}
+
+func TestService_OutputToSyslog(t *testing.T) {
+	path, read := listenDatagrams(t)
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"job": {
+				Type:         TaskTypeOneshot,
+				Cmd:          "sh",
+				Args:         []string{"-c", "echo hello; echo oops >&2"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    time.Second,
+				StopTime:     time.Second,
+				Stdout:       OutputTargetSyslog,
+				Stderr:       OutputTargetSyslog,
+				Syslog:       SyslogConfig{Address: path, Facility: "local0", Tag: "myjob"},
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if _, err := s.Run("job"); err != nil {
+		t.Fatalf("Expected Run to succeed, got %v", err)
+	}
+
+	// local0 is 16: info is 16*8+6, err is 16*8+3.
+	want := map[string]*regexp.Regexp{
+		"hello": regexp.MustCompile(`^<134>1 \S+ \S+ myjob \S+ stdout - hello$`),
+		"oops":  regexp.MustCompile(`^<131>1 \S+ \S+ myjob \S+ stderr - oops$`),
+	}
+	for range 2 {
+		msg := read()
+		re, exists := want[msg[strings.LastIndex(msg, " ")+1:]]
+		if !exists || !re.MatchString(msg) {
+			t.Errorf("Unexpected syslog message %q", msg)
+		}
+	}
+}
+
+func TestService_OutputToJournald(t *testing.T) {
+	path, read := listenDatagrams(t)
+	cfg := &Config{
+		Tasks: map[string]*Task{
+			"job": {
+				Type:         TaskTypeOneshot,
+				Cmd:          "echo",
+				Args:         []string{"hello"},
+				NumProcs:     1,
+				StartRetries: 1,
+				StartTime:    time.Second,
+				StopTime:     time.Second,
+				Stdout:       OutputTargetJournald,
+				Syslog:       SyslogConfig{Address: path},
+			},
+		},
+	}
+	s := New(cfg)
+	defer s.Close()
+
+	if _, err := s.Run("job"); err != nil {
+		t.Fatalf("Expected Run to succeed, got %v", err)
+	}
+
+	entry := read()
+	for _, field := range []string{
+		"MESSAGE=hello\n",
+		"PRIORITY=6\n",
+		"SYSLOG_IDENTIFIER=job\n",
+		"TASKMASTER_PROCESS=job\n",
+	} {
+		if !strings.Contains(entry, field) {
+			t.Errorf("Expected %q in the entry, got %q", field, entry)
+		}
+	}
+}
+
+func TestWriteJournalField(t *testing.T) {
+	var b strings.Builder
+	writeJournalField(&b, "MESSAGE", "a\nb")
+
+	want := "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n"
+	if b.String() != want {
+		t.Errorf("Expected %q, got %q", want, b.String())
+	}
+}
@@ -2,9 +2,12 @@ package taskmaster
 
 import (
 	"fmt"
+	"maps"
+	"math/rand/v2"
 	"reflect"
 	"slices"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -14,12 +17,25 @@ const (
 	AutoRestartAlways     autoRestartValue = "always"
 	AutoRestartNever      autoRestartValue = "never"
 	AutoRestartUnexpecter autoRestartValue = "unexpected"
+
+	TaskTypeService       taskType = "service"
+	TaskTypeOneshot       taskType = "oneshot"
+	TaskTypeEventListener taskType = "eventlistener"
 )
 
 type autoRestartValue string
 
+type taskType string
+
 type Task struct {
 
+	// The kind of program: service (long-running), oneshot (runs to
+	// completion, successful if it exits with one of ExitCodes) or
+	// eventlistener (long-running, fed events on its standard input with the
+	// supervisord protocol).
+	// Default: service.
+	Type taskType `yaml:"type"`
+
 	// The command to use to launch the program.
 	Cmd string `yaml:"cmd"`
 
@@ -61,17 +77,193 @@ type Task struct {
 	// How long to wait after a graceful stop before killing the program.
 	StopTime time.Duration `yaml:"stoptime"`
 
+	// Where to write the output of the program: a file path, syslog or
+	// journald.
 	Stdout string `yaml:"stdout"`
 	Stderr string `yaml:"stderr"`
 
+	// Settings of the syslog and journald outputs.
+	Syslog SyslogConfig `yaml:"syslog"`
+
+	// Whether to send stderr to stdout, as with 2>&1. Lines are then all
+	// from stdout.
+	RedirectStderr bool `yaml:"redirect_stderr"`
+
+	// Whether to start each line of the output files with an RFC3339
+	// timestamp.
+	LogTimestamp bool `yaml:"log_timestamp"`
+
+	// Whether to start each line of the output files with the process name
+	// and the stream, e.g. [worker_01 stderr].
+	LogPrefix bool `yaml:"log_prefix"`
+
+	// The size at which the output files are rotated, as a number of bytes
+	// or with a unit: 512KB, 10MB, 1GB.
+	// Default: 0, never rotated.
+	StdoutMaxBytes ByteSize `yaml:"stdout_maxbytes"`
+	StderrMaxBytes ByteSize `yaml:"stderr_maxbytes"`
+
+	// How many rotated output files to keep. Without backups, a rotated file
+	// is removed.
+	// Default: 0.
+	StdoutBackups int `yaml:"stdout_backups"`
+	StderrBackups int `yaml:"stderr_backups"`
+
+	// Whether to gzip the rotated output files.
+	LogCompress bool `yaml:"log_compress"`
+
+	// How long to keep the rotated output files.
+	// Default: 0, no limit.
+	LogMaxAge time.Duration `yaml:"log_maxage"`
+
 	// Environment variables to set before launching the program.
 	Env map[string]string `yaml:"env"`
+
+	// How long to wait before restarting the program after it exited.
+	Backoff Backoff `yaml:"backoff"`
+
+	// How many restarts are allowed within RestartWindow before the program
+	// is considered in a crash loop and given up.
+	// Default: 0, no limit.
+	MaxRestarts int `yaml:"maxrestarts"`
+
+	// The time window in which restarts are counted.
+	// Default: 10m.
+	RestartWindow time.Duration `yaml:"restartwindow"`
+
+	// Tasks to wait for before starting the program, with the condition
+	// they must meet: started or completed.
+	// Default condition: started.
+	DependsOn map[string]dependsCondition `yaml:"depends_on"`
+
+	// The order in which the program is started and stopped relative to the
+	// others. Lower priorities start first and stop last.
+	// Default: 0.
+	Priority int `yaml:"priority"`
+
+	// How to probe the program to tell if it is healthy.
+	HealthCheck *HealthCheck `yaml:"healthcheck"`
+
+	// Whether the program notifies its readiness with READY=1 on the
+	// NOTIFY_SOCKET, as with systemd. It is then running once ready, and
+	// StartTime is how long to wait for it.
+	Notify bool `yaml:"notify"`
+
+	// How long the program can go without sending WATCHDOG=1 before being
+	// restarted. Requires notify.
+	Watchdog time.Duration `yaml:"watchdog"`
+
+	// A cron expression (5 or 6 fields, @daily, @every 5m...) to start the
+	// program on. A scheduled program runs to completion.
+	Schedule string `yaml:"schedule"`
+
+	// What to do when a scheduled run is due while the previous one is still
+	// active: allow (run it too, in an extra instance removed once done),
+	// forbid (skip the run) or replace (stop the previous run).
+	// Default: forbid.
+	Concurrency concurrencyPolicy `yaml:"concurrency"`
+
+	// What to do with the runs missed while the daemon was down: skip or
+	// runonce.
+	// Default: skip.
+	MissedRuns missedRunPolicy `yaml:"missedruns"`
+
+	// How long the program can run before being stopped.
+	// Default: 0, no limit.
+	MaxRuntime time.Duration `yaml:"maxruntime"`
+
+	// The supervisord events an eventlistener is fed: PROCESS_STATE,
+	// PROCESS_STATE_STARTING, _RUNNING, _BACKOFF, _STOPPING, _EXITED,
+	// _STOPPED, _FATAL, TICK_5, TICK_60, TICK_3600 or EVENT for all of them.
+	Events []string `yaml:"events"`
+
+	// How many events wait for each process of an eventlistener before the
+	// oldest ones are dropped.
+	// Default: 10.
+	BufferSize int `yaml:"buffer_size"`
+
+	// Whether the resource stats of the program include all its
+	// descendants rather than its own only.
+	// Default: false.
+	StatsTree bool `yaml:"stats_tree"`
+
+	// The resident memory above which the limit action is taken.
+	// Default: 0, no limit.
+	MemoryLimit ByteSize `yaml:"memory_limit"`
+
+	// The CPU usage, 100 being a whole CPU, above which the limit action is
+	// taken, optionally once sustained for a while: 90 or "90 for 2m".
+	// Default: 0, no limit.
+	CPULimit CPULimit `yaml:"cpu_limit_percent"`
+
+	// The number of open files above which the limit action is taken.
+	// Default: 0, no limit.
+	MaxFDs int `yaml:"max_fds"`
+
+	// What to do when a limit is crossed: log, notify (a limit event), signal
+	// (send LimitSignal) or restart (gracefully, with StopSignal and
+	// StopTime). Limits are checked on each stats sample, a reload changes
+	// them without restarting the program.
+	// Default: restart.
+	LimitAction limitAction `yaml:"limit_action"`
+
+	// The signal sent by the signal action: TERM, INT, KILL, HUP, USR1, USR2.
+	// Default: none, required by the signal action.
+	LimitSignal string `yaml:"limit_signal"`
+}
+
+// Backoff configures the delay between restarts of a program exiting
+// unexpectedly. The delay grows by Multiplier on each restart, up to Max.
+type Backoff struct {
+
+	// The delay before the first restart.
+	// Default: 1s.
+	Initial time.Duration `yaml:"initial"`
+
+	// The factor applied to the delay on each restart.
+	// Default: 2.
+	Multiplier float64 `yaml:"multiplier"`
+
+	// The maximum delay.
+	// Default: 1m.
+	Max time.Duration `yaml:"max"`
+
+	// The fraction of the delay to randomly add or remove, from 0 to 1.
+	Jitter float64 `yaml:"jitter"`
+
+	// How long the program should be running for the delay to be reset to
+	// Initial.
+	// Default: 1m.
+	Reset time.Duration `yaml:"reset"`
+}
+
+// next returns the delay to wait after prev. A zero prev gives Initial.
+func (b Backoff) next(prev time.Duration) time.Duration {
+	if prev <= 0 {
+		return b.Initial
+	}
+
+	next := time.Duration(float64(prev) * b.Multiplier)
+	if next > b.Max || next <= 0 {
+		next = b.Max
+	}
+	return next
+}
+
+// jitter randomly spreads d by Jitter.
+func (b Backoff) jitter(d time.Duration) time.Duration {
+	if b.Jitter <= 0 {
+		return d
+	}
+
+	return d + time.Duration(float64(d)*b.Jitter*(2*rand.Float64()-1))
 }
 
 // Compare checks if two Task instances are identical in all fields.
 // It returns true if all fields are equal, otherwise it returns false.
 func (t Task) Compare(u Task) bool {
-	return t.Cmd == u.Cmd &&
+	return t.Type == u.Type &&
+		t.Cmd == u.Cmd &&
 		reflect.DeepEqual(t.Args, u.Args) &&
 		t.NumProcs == u.NumProcs &&
 		t.Umask == u.Umask &&
@@ -85,12 +277,45 @@ func (t Task) Compare(u Task) bool {
 		t.StopTime == u.StopTime &&
 		t.Stdout == u.Stdout &&
 		t.Stderr == u.Stderr &&
-		reflect.DeepEqual(t.Env, u.Env)
+		t.Syslog == u.Syslog &&
+		t.RedirectStderr == u.RedirectStderr &&
+		t.LogTimestamp == u.LogTimestamp &&
+		t.LogPrefix == u.LogPrefix &&
+		t.StdoutMaxBytes == u.StdoutMaxBytes &&
+		t.StderrMaxBytes == u.StderrMaxBytes &&
+		t.StdoutBackups == u.StdoutBackups &&
+		t.StderrBackups == u.StderrBackups &&
+		t.LogCompress == u.LogCompress &&
+		t.LogMaxAge == u.LogMaxAge &&
+		reflect.DeepEqual(t.Env, u.Env) &&
+		t.Backoff == u.Backoff &&
+		t.MaxRestarts == u.MaxRestarts &&
+		t.RestartWindow == u.RestartWindow &&
+		maps.Equal(t.DependsOn, u.DependsOn) &&
+		t.Priority == u.Priority &&
+		reflect.DeepEqual(t.HealthCheck, u.HealthCheck) &&
+		t.Notify == u.Notify &&
+		t.Watchdog == u.Watchdog &&
+		t.Schedule == u.Schedule &&
+		t.Concurrency == u.Concurrency &&
+		t.MissedRuns == u.MissedRuns &&
+		t.MaxRuntime == u.MaxRuntime &&
+		slices.Equal(t.Events, u.Events) &&
+		t.BufferSize == u.BufferSize &&
+		t.StatsTree == u.StatsTree &&
+		t.MemoryLimit == u.MemoryLimit &&
+		t.CPULimit == u.CPULimit &&
+		t.MaxFDs == u.MaxFDs &&
+		t.LimitAction == u.LimitAction &&
+		t.LimitSignal == u.LimitSignal
 }
 
 // DiffNeedRestart compares two Task instances and returns true if the task need to be restarted.
 func (t Task) DiffNeedRestart(u Task) bool {
 
+	if t.Type != u.Type {
+		return true
+	}
 	if t.Cmd != u.Cmd {
 		return true
 	}
@@ -109,16 +334,57 @@ func (t Task) DiffNeedRestart(u Task) bool {
 	if t.Stderr != u.Stderr {
 		return true
 	}
+	if t.Syslog != u.Syslog {
+		return true
+	}
+	if t.RedirectStderr != u.RedirectStderr {
+		return true
+	}
+	// The outputs of a child are decorated as set when it was spawned.
+	if t.LogTimestamp != u.LogTimestamp || t.LogPrefix != u.LogPrefix {
+		return true
+	}
 	if !reflect.DeepEqual(t.Env, u.Env) {
 		return true
 	}
+	if t.Notify != u.Notify {
+		return true
+	}
+	if !slices.Equal(t.Events, u.Events) || t.BufferSize != u.BufferSize {
+		return true
+	}
+	// The supervisor of a process reads them from the task it was made
+	// with.
+	if t.Backoff != u.Backoff || t.MaxRestarts != u.MaxRestarts || t.RestartWindow != u.RestartWindow {
+		return true
+	}
+	if !reflect.DeepEqual(t.HealthCheck, u.HealthCheck) {
+		return true
+	}
+	// The child is told its watchdog when spawned.
+	if t.Watchdog != u.Watchdog {
+		return true
+	}
+	// The ordered starts and stops read the dependencies and the priority
+	// of the processes.
+	if !maps.Equal(t.DependsOn, u.DependsOn) {
+		return true
+	}
+	if t.Priority != u.Priority {
+		return true
+	}
+	// The run of a scheduled process reads its schedule and its max runtime.
+	if t.Schedule != u.Schedule || t.MaxRuntime != u.MaxRuntime {
+		return true
+	}
 
 	return false
 }
 
 func (t Task) String() string {
 	return fmt.Sprintf(
-		"Cmd: %s\n  Args: %s\n  NumProcs: %d\n  Umask: %v\n  WorkingDir: %s\n  AutoStart: %v\n  AutoRestart: %s\n  ExitCodes: %v\n  StartRetries: %d\n  StartTime: %d\n  StopSignal: %s\n  StopTime: %d\n  Stdout: %s\n  Stderr: %s\n  Env: %s",
+		"Type: %s\n  Cmd: %s\n  Args: %s\n  NumProcs: %d\n  Umask: %v\n  WorkingDir: %s\n  AutoStart: %v\n  AutoRestart: %s\n  ExitCodes: %v\n  StartRetries: %d\n  StartTime: %d\n  StopSignal: %s\n  StopTime: %d\n  Stdout: %s\n  Stderr: %s\n  Syslog: %+v\n  RedirectStderr: %v\n  LogTimestamp: %v\n  LogPrefix: %v\n  StdoutMaxBytes: %d\n  StderrMaxBytes: %d\n  StdoutBackups: %d\n  StderrBackups: %d\n  LogCompress: %v\n  LogMaxAge: %s\n  Env: %s\n  Backoff: %+v\n  MaxRestarts: %d\n  RestartWindow: %s\n  DependsOn: %v\n  Priority: %d\n  HealthCheck: %+v\n  Notify: %v\n  Watchdog: %s\n  Schedule: %s\n  Concurrency: %s\n  MissedRuns: %s\n  MaxRuntime: %s\n  Events: %v\n  BufferSize: %d\n  StatsTree: %v\n  MemoryLimit: %d\n  CPULimit: %+v\n  MaxFDs: %d\n  LimitAction: %s\n  LimitSignal: %s",
+		t.Type,
 		t.Cmd,
 		strings.Join(t.Args, " "),
 		t.NumProcs,
@@ -133,7 +399,37 @@ func (t Task) String() string {
 		t.StopTime,
 		t.Stdout,
 		t.Stderr,
+		t.Syslog,
+		t.RedirectStderr,
+		t.LogTimestamp,
+		t.LogPrefix,
+		t.StdoutMaxBytes,
+		t.StderrMaxBytes,
+		t.StdoutBackups,
+		t.StderrBackups,
+		t.LogCompress,
+		t.LogMaxAge,
 		fmt.Sprintf("%v", t.Env),
+		t.Backoff,
+		t.MaxRestarts,
+		t.RestartWindow,
+		t.DependsOn,
+		t.Priority,
+		t.HealthCheck,
+		t.Notify,
+		t.Watchdog,
+		t.Schedule,
+		t.Concurrency,
+		t.MissedRuns,
+		t.MaxRuntime,
+		t.Events,
+		t.BufferSize,
+		t.StatsTree,
+		t.MemoryLimit,
+		t.CPULimit,
+		t.MaxFDs,
+		t.LimitAction,
+		t.LimitSignal,
 	)
 }
 
@@ -161,3 +457,32 @@ func (t Task) isExpectedExitCode(exitCode int) bool {
 
 	return slices.Contains(expectedCodes, exitCode)
 }
+
+// stopSignal returns the signal to send to gracefully stop the program.
+func (t Task) stopSignal() (syscall.Signal, error) {
+	sig, ok := parseSignal(t.StopSignal)
+	if !ok {
+		return 0, fmt.Errorf("unsupported stop signal: %s", t.StopSignal)
+	}
+	return sig, nil
+}
+
+// parseSignal returns the signal named name, TERM if it is empty.
+func parseSignal(name string) (syscall.Signal, bool) {
+	switch name {
+	case "", "TERM", "SIGTERM":
+		return syscall.SIGTERM, true
+	case "INT", "SIGINT":
+		return syscall.SIGINT, true
+	case "KILL", "SIGKILL":
+		return syscall.SIGKILL, true
+	case "HUP", "SIGHUP":
+		return syscall.SIGHUP, true
+	case "USR1", "SIGUSR1":
+		return syscall.SIGUSR1, true
+	case "USR2", "SIGUSR2":
+		return syscall.SIGUSR2, true
+	default:
+		return 0, false
+	}
+}
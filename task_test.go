@@ -2,6 +2,7 @@ package taskmaster
 
 import (
 	"testing"
+	"time"
 )
 
 func TestTaskDiffNeedRestart(t *testing.T) {
@@ -19,6 +20,27 @@ func TestTaskDiffNeedRestart(t *testing.T) {
 	if !task1.DiffNeedRestart(task2) {
 		t.Error("Expected tasks to need restart")
 	}
+
+	for _, task := range []Task{
+		{Cmd: "echo", LogTimestamp: true},
+		{Cmd: "echo", LogPrefix: true},
+		{Cmd: "echo", MaxRestarts: 3},
+		{Cmd: "echo", RestartWindow: time.Minute},
+		{Cmd: "echo", Backoff: Backoff{Initial: time.Second}},
+		{Cmd: "echo", HealthCheck: &HealthCheck{Type: HealthCheckTCP}},
+		{Cmd: "echo", Watchdog: time.Second},
+		{Cmd: "echo", DependsOn: map[string]dependsCondition{"db": DependsStarted}},
+		{Cmd: "echo", Priority: 10},
+		{Cmd: "echo", Schedule: "@daily"},
+		{Cmd: "echo", MaxRuntime: time.Minute},
+	} {
+		if !task.DiffNeedRestart(Task{Cmd: "echo"}) {
+			t.Errorf("Expected %+v to need restart", task)
+		}
+	}
+	if (Task{Cmd: "echo", MemoryLimit: 1024}).DiffNeedRestart(Task{Cmd: "echo"}) {
+		t.Error("Expected a limit to apply without restart")
+	}
 }
 
 func TestTaskShouldRestart(t *testing.T) {
@@ -43,3 +65,31 @@ func TestTaskIsExpectedExitCode(t *testing.T) {
 		t.Error("Expected exit code not to be expected")
 	}
 }
+
+func TestBackoffNext(t *testing.T) {
+	b := Backoff{
+		Initial:    time.Second,
+		Multiplier: 2,
+		Max:        5 * time.Second,
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	var d time.Duration
+	for i, w := range want {
+		d = b.next(d)
+		if d != w {
+			t.Errorf("step %d: expected %s, got %s", i, w, d)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := Backoff{Jitter: 0.5}
+
+	for range 100 {
+		d := b.jitter(time.Second)
+		if d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("Expected jittered delay within 50%%, got %s", d)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package term
+
+import (
+	"context"
+	"syscall"
+	"time"
+)
+
+// interruptPollInterval is how often stdin is checked for an interrupt.
+const interruptPollInterval = 100 * time.Millisecond
+
+// Interruptible returns a context cancelled when the user presses Ctrl+C or
+// q, for commands running until interrupted. stop must be called once the
+// command ended, to give stdin back to the prompt.
+func (t *Term) Interruptible(parent context.Context) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+	if err := syscall.SetNonblock(syscall.Stdin, true); err != nil {
+		return ctx, cancel
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interruptPollInterval)
+		defer ticker.Stop()
+
+		var buf [1]byte
+		for {
+			n, err := syscall.Read(syscall.Stdin, buf[:])
+			switch {
+			case n == 1 && (buf[0] == ETX || buf[0] == 'q'):
+				cancel()
+				return
+			case n == 1:
+				continue
+			case err != syscall.EAGAIN:
+				// stdin is closed or unusable, only ctx ends the command.
+				<-ctx.Done()
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	stop = func() {
+		cancel()
+		<-done
+		syscall.SetNonblock(syscall.Stdin, false)
+	}
+	return ctx, stop
+}
@@ -228,6 +228,11 @@ func (t *Term) executeCmd(cmdLine string) error {
 	return err
 }
 
+// Exec runs a single command line, without the interactive prompt.
+func (t *Term) Exec(cmdLine string) error {
+	return t.executeCmd(cmdLine)
+}
+
 func (t *Term) Run() error {
 	fmt.Println("Welcome to taskmaster! Type 'exit' to quit.")
 
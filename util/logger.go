@@ -5,54 +5,127 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"net/http"
-	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
+	"time"
 )
 
+// webhookDrainTimeout is how long Close waits for the webhook to deliver
+// the last records.
+const webhookDrainTimeout = 10 * time.Second
+
+const (
+	// LogFormatText is the format of taskmaster: [time] LEVEL: message attrs.
+	LogFormatText = "text"
+	// LogFormatJSON writes a JSON object per record.
+	LogFormatJSON = "json"
+	// LogFormatLogfmt writes key=value pairs.
+	LogFormatLogfmt = "logfmt"
+)
+
+var LogFormats = []string{LogFormatText, LogFormatJSON, LogFormatLogfmt}
+
 type LoggerHandler struct {
 	handler slog.Handler
-	url     string
-	form    url.Values
+	format  string
+	source  bool
+	webhook *Webhook
+	tee     io.Writer
 	mu      *sync.Mutex
 	w       io.Writer
 }
 
+// LoggerOptFn configures a LoggerHandler.
+type LoggerOptFn func(*LoggerHandler, *slog.HandlerOptions)
+
+// WithFormat sets one of LogFormats, LogFormatText by default.
+func WithFormat(format string) LoggerOptFn {
+	return func(h *LoggerHandler, _ *slog.HandlerOptions) {
+		if format != "" {
+			h.format = format
+		}
+	}
+}
+
+// WithLevel sets the minimum level of the records, it can be changed while
+// logging.
+func WithLevel(level *slog.LevelVar) LoggerOptFn {
+	return func(_ *LoggerHandler, opts *slog.HandlerOptions) {
+		opts.Level = level
+	}
+}
+
+// WithSource adds the source file and line of the records.
+func WithSource(source bool) LoggerOptFn {
+	return func(h *LoggerHandler, opts *slog.HandlerOptions) {
+		h.source = source
+		opts.AddSource = source
+	}
+}
+
+// WithTee also writes the records to w in the text format, whatever the
+// format of the handler.
+func WithTee(w io.Writer) LoggerOptFn {
+	return func(h *LoggerHandler, _ *slog.HandlerOptions) {
+		h.tee = w
+	}
+}
+
 func (h *LoggerHandler) clone() *LoggerHandler {
 	return &LoggerHandler{
 		handler: h.handler,
-		url:     h.url,
-		form:    h.form,
+		format:  h.format,
+		source:  h.source,
+		webhook: h.webhook,
+		tee:     h.tee,
 		mu:      h.mu,
 		w:       h.w,
 	}
 }
 
-func NewLogger(whUrl string, w io.Writer) *LoggerHandler {
-	form := url.Values{}
-	hostname, err := os.Hostname()
-	if err != nil {
-		form.Set("username", "Taskmaster")
-	} else {
-		form.Set("username", hostname)
-	}
-
-	opts := slog.HandlerOptions{}
-	if os.Getenv("DEBUG") == "true" {
-		opts.AddSource = true
-		opts.Level = slog.LevelDebug
+func NewLogger(whUrl string, w io.Writer, opts ...LoggerOptFn) *LoggerHandler {
+	var webhook *Webhook
+	if whUrl != "" {
+		username, err := os.Hostname()
+		if err != nil {
+			username = "Taskmaster"
+		}
+		webhook = NewWebhook(whUrl, username)
 	}
-	handler := slog.NewTextHandler(w, &opts)
 
-	return &LoggerHandler{
-		handler: handler,
-		url:     whUrl,
-		form:    form,
+	h := &LoggerHandler{
+		format:  LogFormatText,
+		webhook: webhook,
 		mu:      new(sync.Mutex),
 		w:       w,
 	}
+	handlerOpts := slog.HandlerOptions{}
+	for _, fn := range opts {
+		fn(h, &handlerOpts)
+	}
+
+	switch h.format {
+	case LogFormatJSON:
+		h.handler = slog.NewJSONHandler(w, &handlerOpts)
+	default:
+		h.handler = slog.NewTextHandler(w, &handlerOpts)
+	}
+
+	return h
+}
+
+// Close delivers the records queued for the webhook.
+func (h *LoggerHandler) Close() error {
+	if h.webhook == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookDrainTimeout)
+	defer cancel()
+	return h.webhook.Close(ctx)
 }
 
 // Enabled checks if the given log level is enabled.
@@ -60,7 +133,8 @@ func (h *LoggerHandler) Enabled(ctx context.Context, level slog.Level) bool {
 	return h.handler.Enabled(ctx, level)
 }
 
-// Handle processes a log record and sends it to the Discord webhook.
+// Handle writes a log record in the format of the handler and queues it for
+// the Discord webhook.
 func (h *LoggerHandler) Handle(ctx context.Context, r slog.Record) error {
 	var str strings.Builder
 
@@ -73,28 +147,27 @@ func (h *LoggerHandler) Handle(ctx context.Context, r slog.Record) error {
 		attrs = append(attrs, a.String())
 		return true
 	})
+	if h.source && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		attrs = append(attrs, fmt.Sprintf("source=%s:%d", filepath.Base(frame.File), frame.Line))
+	}
 
 	str.Write([]byte(strings.Join(attrs, " ")))
-	h.mu.Lock()
-	fmt.Fprintln(h.w, str.String())
-	h.mu.Unlock()
 
-	// First, pass the record to the underlying handler
-	// if err := h.handler.Handle(ctx, r); err != nil {
-	// 	return err
-	// }
-
-	if h.url == "" {
-		return nil
+	if h.format == LogFormatText {
+		h.mu.Lock()
+		fmt.Fprintln(h.w, str.String())
+		h.mu.Unlock()
+	} else if err := h.handler.Handle(ctx, r); err != nil {
+		return err
 	}
 
-	h.form.Set("content", str.String())
-
-	resp, err := http.PostForm(h.url, h.form)
-	if err != nil {
-		return err
+	if h.tee != nil {
+		fmt.Fprintln(h.tee, str.String())
+	}
+	if h.webhook != nil {
+		h.webhook.Send(str.String())
 	}
-	defer resp.Body.Close()
 
 	return nil
 }
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger_Formats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{LogFormatText, "INFO: spawned process=web"},
+		{LogFormatJSON, `"msg":"spawned","process":"web"`},
+		{LogFormatLogfmt, "level=INFO msg=spawned process=web"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		logger := slog.New(NewLogger("", &buf, WithFormat(tt.format)))
+		logger.Info("spawned", slog.String("process", "web"))
+
+		if !strings.Contains(buf.String(), tt.want) {
+			t.Errorf("%s: expected %q in %q", tt.format, tt.want, buf.String())
+		}
+	}
+}
+
+func TestLogger_LevelAndSource(t *testing.T) {
+	var buf bytes.Buffer
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelWarn)
+	logger := slog.New(NewLogger("", &buf, WithFormat(LogFormatJSON), WithLevel(level), WithSource(true)))
+
+	logger.Info("hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("Expected info to be filtered, got %q", buf.String())
+	}
+
+	level.Set(slog.LevelDebug)
+	logger.Debug("shown")
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["msg"] != "shown" || record["source"] == nil {
+		t.Errorf("Expected a debug record with its source, got %v", record)
+	}
+}
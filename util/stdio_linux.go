@@ -0,0 +1,19 @@
+//go:build linux
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// RedirectStdio makes the standard output and error write to file.
+func RedirectStdio(file *os.File) error {
+	for _, fd := range []int{syscall.Stdout, syscall.Stderr} {
+		if err := syscall.Dup3(int(file.Fd()), fd, 0); err != nil {
+			return fmt.Errorf("failed to redirect fd %d: %w", fd, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// How many messages wait for delivery before new ones are dropped.
+	webhookQueueSize = 256
+
+	// How many messages are sent in a single post, and how long to wait for
+	// more after the first one.
+	webhookBatchSize  = 20
+	webhookBatchDelay = time.Second
+
+	// The maximum length of a post, as with Discord.
+	webhookMaxContent = 2000
+
+	// The minimum delay between two posts.
+	webhookRateInterval = 500 * time.Millisecond
+
+	// How many times a post is retried, with a delay doubling from
+	// webhookRetryDelay.
+	webhookMaxRetries = 3
+	webhookRetryDelay = time.Second
+
+	webhookTimeout = 10 * time.Second
+)
+
+var errWebhookRejected = errors.New("webhook: message rejected")
+
+// Webhook delivers messages to a webhook url in the background, by batches,
+// without posting more often than webhookRateInterval. When its queue is
+// full, new messages are dropped and their count is sent later.
+type Webhook struct {
+	url      string
+	username string
+	client   *http.Client
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+
+	queue chan string
+	done  chan struct{}
+
+	// stop aborts the deliveries in progress.
+	ctx  context.Context
+	stop context.CancelFunc
+}
+
+// NewWebhook starts delivering messages to whURL.
+func NewWebhook(whURL, username string) *Webhook {
+	ctx, stop := context.WithCancel(context.Background())
+	w := &Webhook{
+		url:      whURL,
+		username: username,
+		client:   &http.Client{Timeout: webhookTimeout},
+		queue:    make(chan string, webhookQueueSize),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		stop:     stop,
+	}
+	go w.run()
+
+	return w
+}
+
+// Send queues a message without blocking. It is dropped if the queue is full
+// or the webhook is closed.
+func (w *Webhook) Send(msg string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	select {
+	case w.queue <- msg:
+	default:
+		w.dropped++
+	}
+}
+
+// Close stops accepting messages and waits for the queued ones to be
+// delivered, or for ctx to be done.
+func (w *Webhook) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		w.stop()
+		<-w.done
+		return fmt.Errorf("webhook: undelivered messages: %w", ctx.Err())
+	}
+}
+
+func (w *Webhook) run() {
+	defer close(w.done)
+
+	var last time.Time
+	for {
+		batch, open := w.nextBatch()
+		if len(batch) > 0 {
+			for _, content := range w.contents(batch) {
+				if wait := webhookRateInterval - time.Since(last); wait > 0 {
+					w.sleep(wait)
+				}
+				w.deliver(content)
+				last = time.Now()
+			}
+		}
+		if !open {
+			return
+		}
+	}
+}
+
+// nextBatch waits for a message, then for more during webhookBatchDelay. It
+// returns false once the queue is closed and empty.
+func (w *Webhook) nextBatch() ([]string, bool) {
+	msg, open := <-w.queue
+	if !open {
+		return nil, false
+	}
+	batch := []string{msg}
+
+	timer := time.NewTimer(webhookBatchDelay)
+	defer timer.Stop()
+	for len(batch) < webhookBatchSize {
+		select {
+		case msg, open := <-w.queue:
+			if !open {
+				return batch, false
+			}
+			batch = append(batch, msg)
+		case <-timer.C:
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+// contents joins a batch in posts no longer than webhookMaxContent.
+func (w *Webhook) contents(batch []string) []string {
+	w.mu.Lock()
+	if w.dropped > 0 {
+		batch = append(batch, fmt.Sprintf("(%d messages dropped)", w.dropped))
+		w.dropped = 0
+	}
+	w.mu.Unlock()
+
+	var contents []string
+	var content strings.Builder
+	for _, msg := range batch {
+		if len(msg) > webhookMaxContent {
+			// Cut on a rune boundary, the content must stay valid UTF-8.
+			i := webhookMaxContent
+			for i > 0 && !utf8.RuneStart(msg[i]) {
+				i--
+			}
+			msg = msg[:i]
+		}
+		if content.Len() > 0 && content.Len()+len(msg)+1 > webhookMaxContent {
+			contents = append(contents, content.String())
+			content.Reset()
+		}
+		if content.Len() > 0 {
+			content.WriteByte('\n')
+		}
+		content.WriteString(msg)
+	}
+	return append(contents, content.String())
+}
+
+// deliver posts content, retrying on failure.
+func (w *Webhook) deliver(content string) {
+	delay := webhookRetryDelay
+	for try := 0; ; try++ {
+		retryAfter, err := w.post(content)
+		if err == nil || errors.Is(err, errWebhookRejected) || try == webhookMaxRetries || w.ctx.Err() != nil {
+			return
+		}
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		w.sleep(delay)
+		delay *= 2
+	}
+}
+
+// post sends content once. On a rate limit, it returns how long to wait.
+func (w *Webhook) post(content string) (time.Duration, error) {
+	form := url.Values{}
+	form.Set("username", w.username)
+	form.Set("content", content)
+
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		seconds, _ := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64)
+		return time.Duration(seconds * float64(time.Second)), errors.New("webhook: rate limited")
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return 0, fmt.Errorf("%w: %s", errWebhookRejected, resp.Status)
+	case resp.StatusCode >= 300:
+		return 0, fmt.Errorf("webhook: unexpected status: %s", resp.Status)
+	}
+	return 0, nil
+}
+
+// sleep waits for d, or until the deliveries are aborted.
+func (w *Webhook) sleep(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-w.ctx.Done():
+	}
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestWebhook_BatchesAndDrains(t *testing.T) {
+	var mu sync.Mutex
+	var posts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		posts = append(posts, r.FormValue("content"))
+		if len(posts) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	w := NewWebhook(server.URL, "test")
+	w.Send("exiting...")
+	w.Send("service closed")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	w.Send("too late")
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := "exiting...\nservice closed"
+	if len(posts) != 2 || posts[0] != want || posts[1] != want {
+		t.Fatalf("posts: got %q, want the batch twice", posts)
+	}
+}
+
+func TestWebhook_Contents(t *testing.T) {
+	w := &Webhook{dropped: 3}
+	long := strings.Repeat("a", webhookMaxContent-10)
+
+	contents := w.contents([]string{long, "second", long + "too long to fit"})
+	if len(contents) != 3 {
+		t.Fatalf("got %d posts, want 3", len(contents))
+	}
+	if contents[0] != long+"\nsecond" {
+		t.Errorf("first post: got %q", contents[0][len(long):])
+	}
+	for _, content := range contents {
+		if len(content) > webhookMaxContent {
+			t.Errorf("post too long: %d", len(content))
+		}
+	}
+	if contents[2] != "(3 messages dropped)" {
+		t.Errorf("last post: got %q", contents[2])
+	}
+}
+
+func TestWebhook_ContentsFullMessage(t *testing.T) {
+	w := &Webhook{}
+	full := strings.Repeat("a", webhookMaxContent)
+
+	contents := w.contents([]string{full, "second"})
+	if len(contents) != 2 || contents[0] != full || contents[1] != "second" {
+		t.Fatalf("got %d posts, want the full message then the second one", len(contents))
+	}
+}
+
+func TestWebhook_ContentsRuneBoundary(t *testing.T) {
+	w := &Webhook{}
+	msg := "a" + strings.Repeat("é", webhookMaxContent)
+
+	contents := w.contents([]string{msg})
+	if len(contents) != 1 || !utf8.ValidString(contents[0]) || len(contents[0]) != webhookMaxContent-1 {
+		t.Fatalf("got %d bytes, want %d bytes of valid UTF-8", len(contents[0]), webhookMaxContent-1)
+	}
+}